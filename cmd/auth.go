@@ -0,0 +1,163 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib/auth"
+)
+
+// authCmd represents the auth command
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Log in with a biometric challenge-response handshake",
+	Long: `Proves to a server that a subject can reproduce the key of its enrollment,
+without the key or the capture leaving the client. The server issues a
+challenge with a fresh nonce, the client reproduces the key from a capture and
+signs the challenge with Schnorr, and the server checks the response against
+the enrolled public key. Every challenge expires after --ttl and is accepted
+once, so a response cannot be replayed. The enrollment must be made with
+--alg schnorr or bip340. For example:
+
+  gofze enroll tc/103_6.jpg --alg bip340 --subject alice
+  gofze auth challenge --subject alice -o challenge.json
+  gofze auth respond challenge.json tc/103_7.jpg --subject alice -o response.json
+  gofze auth check response.json --subject alice`,
+}
+
+var authChallengeCmd = &cobra.Command{
+	Use:   "challenge",
+	Short: "Issue a challenge to the holder of an enrollment",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		e := readEnrollment(cmd)
+		subject, _ := cmd.Flags().GetString("subject")
+
+		c, err := newVerifier(cmd).Challenge(subject, e)
+		if err != nil {
+			log.Fatalf("Error in Challenge: %v", err)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if err := auth.SaveChallenge(output, c); err != nil {
+			log.Fatalf("Error in Writing Challenge: %v", err)
+		}
+		log.Println("Nonce     :\n", hex.EncodeToString(c.Nonce))
+		log.Println("Expires   :\n", c.ExpiresAt)
+		log.Println("Challenge :\n", output)
+	},
+}
+
+var authRespondCmd = &cobra.Command{
+	Use:   "respond <challenge> [image|template]...",
+	Short: "Answer a challenge with the key reproduced from biometric captures",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := auth.LoadChallenge(args[0])
+		if err != nil {
+			log.Fatalf("Error in Reading Challenge: %v", err)
+		}
+
+		e := readEnrollment(cmd)
+		if c.EnrollmentID != e.ID {
+			log.Fatalf("Error in Reading Challenge: challenge was issued to enrollment %s", c.EnrollmentID)
+		}
+		key, err := reproduceKey(cmd, args[1:], e)
+		if err != nil {
+			log.Fatalf("Error in Fuzzy Extraction: %v", err)
+		}
+		signer, err := e.Signer(key, "")
+		if err != nil {
+			log.Fatalf("Error in Signer: %v", err)
+		}
+		refuseRevoked(cmd, e.ID, signer.PublicKey())
+
+		r, err := auth.Respond(c, signer)
+		if err != nil {
+			log.Fatalf("Error in Respond: %v", err)
+		}
+		output, _ := cmd.Flags().GetString("output")
+		if err := auth.SaveResponse(output, r); err != nil {
+			log.Fatalf("Error in Writing Response: %v", err)
+		}
+		log.Println("Public Key:\n", hex.EncodeToString(signer.PublicKey()))
+		log.Println("Response  :\n", output)
+	},
+}
+
+var authCheckCmd = &cobra.Command{
+	Use:   "check <response>",
+	Short: "Check the response to a challenge, accepting it once",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		r, err := auth.LoadResponse(args[0])
+		if err != nil {
+			log.Fatalf("Error in Reading Response: %v", err)
+		}
+
+		e := readEnrollment(cmd)
+		c, err := newVerifier(cmd).Check(r, e)
+		if err != nil {
+			log.Fatalf("Error in Check: %v", err)
+		}
+		log.Println("Subject   :\n", c.Subject)
+		log.Println("Enrollment:\n", c.EnrollmentID)
+		log.Println("Authenticated")
+	},
+}
+
+// newVerifier keeps the pending challenges in the --challenges directory,
+// issuing them for --ttl.
+func newVerifier(cmd *cobra.Command) auth.Verifier {
+	path, _ := cmd.Flags().GetString("challenges")
+	challenges, err := auth.NewDirStore(path)
+	if err != nil {
+		log.Fatalf("Error in Opening Challenges: %v", err)
+	}
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	return auth.NewVerifier(challenges, ttl)
+}
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authChallengeCmd, authRespondCmd, authCheckCmd)
+
+	for _, c := range []*cobra.Command{authChallengeCmd, authRespondCmd, authCheckCmd} {
+		c.Flags().String("enrollment", "enrollment.json", "enrollment record of the subject")
+		c.Flags().String("subject", "", "subject whose last enrollment in the store is used instead of --enrollment")
+		c.Flags().String("revocations", "revocations.json", "revocation list refusing revoked enrollments")
+		addStoreFlags(c.Flags())
+	}
+	for _, c := range []*cobra.Command{authChallengeCmd, authCheckCmd} {
+		c.Flags().String("challenges", "challenges", "directory holding the challenges issued and not yet answered")
+	}
+	addSourceFlags(authRespondCmd)
+	addEnrollFlags(authRespondCmd)
+
+	authChallengeCmd.Flags().Duration("ttl", auth.DefaultTTL, "time the challenge may be answered in")
+	authChallengeCmd.Flags().StringP("output", "o", "challenge.json", "challenge to write")
+	authRespondCmd.Flags().StringP("output", "o", "response.json", "response to write")
+}
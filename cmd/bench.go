@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib/bench"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Benchmark Gen and Rep over a grid of extractor parameters",
+	Long: `Measures Gen and worst-case Rep (an impostor reading that tries every locker)
+on this machine for the extractor word widths of --widths, and prints ns/op,
+allocations and helper-data size for every combination of the given settings.
+For example:
+
+  gofze bench --widths 8,16,32,64 --bits 128,256 --kdf sha256:1,sha256:1000`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		widths, _ := cmd.Flags().GetIntSlice("widths")
+		bits, _ := cmd.Flags().GetIntSlice("bits")
+		hammingErrors, _ := cmd.Flags().GetIntSlice("hamming-errors")
+		settings, _ := cmd.Flags().GetStringSlice("kdf")
+
+		kdfs := make([]bench.KDF, len(settings))
+		for i, setting := range settings {
+			kdf, err := bench.ParseKDF(setting)
+			if err != nil {
+				log.Fatalf("Error in KDF Setting: %v", err)
+			}
+			kdfs[i] = kdf
+		}
+
+		results := []bench.Result{}
+		for _, c := range bench.Grid(widths, bits, hammingErrors, kdfs) {
+			log.Println("Benchmark :", c)
+			r, err := bench.Run(c)
+			if err != nil {
+				log.Fatalf("Error in Benchmark: %v", err)
+			}
+			results = append(results, r)
+		}
+
+		if err := bench.WriteTable(os.Stdout, results); err != nil {
+			log.Fatalf("Error in Writing Table: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().IntSlice("widths", []int{8, 32}, "extractor word widths in bits (8, 16, 32 or 64)")
+	benchCmd.Flags().IntSlice("bits", []int{128, 256}, "biometric vector sizes in bits")
+	benchCmd.Flags().IntSlice("hamming-errors", []int{2, 4}, "hamming errors")
+	benchCmd.Flags().StringSlice("kdf", []string{"sha256:1"}, "locker KDFs as hash:iterations (sha256 or sha512)")
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// berCmd represents the ber command
+var berCmd = &cobra.Command{
+	Use:   "ber <reference> <probe>...",
+	Short: "Measure bit-error rates of binarized embeddings",
+	Long: `Binarizes float embeddings (.npy or .json) with the seeded random-hyperplane
+LSH used for embedding enrollment and reports the bit-error rate of every probe
+against the reference. Genuine probes should stay well below the error rate the
+fuzzy extractor is sized for, while impostors should sit close to 0.5.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		bits, _ := cmd.Flags().GetInt("bits")
+		seedHex, _ := cmd.Flags().GetString("seed")
+
+		seed := lib.NewSeed()
+		if seedHex != "" {
+			var err error
+			seed, err = hex.DecodeString(seedHex)
+			if err != nil {
+				log.Fatalf("Error in Seed: %v", err)
+			}
+		}
+
+		reference, err := lib.NewEmbeddingSource(args[0], bits, seed).Features()
+		if err != nil {
+			log.Fatalf("Error in Reference Embedding: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "seed\t%s\n", hex.EncodeToString(seed))
+		fmt.Fprintln(w, "probe\tbit errors\tbit-error rate")
+
+		total := 0.0
+		for _, path := range args[1:] {
+			probe, err := lib.NewEmbeddingSource(path, bits, seed).Features()
+			if err != nil {
+				log.Fatalf("Error in Probe Embedding: %v", err)
+			}
+
+			ber, err := lib.BitErrorRate(reference, probe)
+			if err != nil {
+				log.Fatalf("Error in Bit-Error Rate: %v", err)
+			}
+			total += ber
+			fmt.Fprintf(w, "%s\t%d\t%.4f\n", path, int(ber*float64(bits)+0.5), ber)
+		}
+		fmt.Fprintf(w, "mean\t\t%.4f\n", total/float64(len(args)-1))
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(berCmd)
+
+	berCmd.Flags().Int("bits", 256, "number of projected bits")
+	berCmd.Flags().String("seed", "", "hex encoded projection seed (random if empty)")
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// enrollCmd represents the enroll command
+var enrollCmd = &cobra.Command{
+	Use:   "enroll [image|template]...",
+	Short: "Enroll biometric captures and write the enrollment record",
+	Long: `Generates a key from biometric captures and writes the helper data needed to
+reproduce it, without keeping the key itself. For example:
+
+  gofze enroll tc/103_6.jpg                      single capture
+  gofze enroll tc/106_3.jpg tc/106_4.jpg ...     several captures of one finger
+  gofze enroll --finger a1.jpg,a2.jpg --finger b1.jpg --finger c1.jpg --threshold 2
+
+The record is then passed to "gofze sign --enrollment". With --password-file or
+--recipient the helper data is sealed, so the record is useless without that
+password or the identity of the recipient as a second factor:
+
+  gofze identity -o me.key
+  gofze enroll tc/103_6.jpg --recipient <hex>
+  gofze sign doc.pdf tc/103_7.jpg --enrollment enrollment.json --identity me.key
+
+With --robust the helper data is authenticated with a MAC keyed from the key,
+so helpers that were tampered with are rejected instead of reproducing a wrong
+key or revealing bits chosen by the attacker.
+
+Every record has an ID and the public key it signs with. If a record leaks,
+--rotate re-enrolls the finger under a fresh key and adds the old record to the
+local revocation list, which sign and verify consult:
+
+  gofze enroll tc/103_6.jpg --rotate enrollment.json -o enrollment2.json
+
+With --subject the record is kept in an enrollment store instead, see
+"gofze enrollments".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var revoked *lib.Revocation
+		if path, _ := cmd.Flags().GetString("rotate"); path != "" {
+			var err error
+			if revoked, err = rotation(cmd, path, args); err != nil {
+				log.Fatalf("Error in Rotation: %v", err)
+			}
+		}
+
+		key, e, err := enrollKey(cmd, args)
+		if err != nil {
+			log.Fatalf("Error in Enrollment: %v", err)
+		}
+		alg, _ := cmd.Flags().GetString("alg")
+		signer, err := e.Signer(key, alg)
+		if err != nil {
+			log.Fatalf("Error in Signer: %v", err)
+		}
+		e.ID = lib.NewEnrollmentID()
+		e.Algorithm, e.PublicKey = signer.Algorithm(), signer.PublicKey()
+
+		if err := sealHelpers(cmd, e); err != nil {
+			log.Fatalf("Error in Sealing Helpers: %v", err)
+		}
+
+		// Records of a subject go to the store unless a file is named too
+		if subject, _ := cmd.Flags().GetString("subject"); subject != "" {
+			s := openStore(cmd)
+			defer s.Close()
+			if err := s.Put(subject, e); err != nil {
+				log.Fatalf("Error in Storing Enrollment: %v", err)
+			}
+			log.Println("Subject   :\n", subject)
+		}
+		if subject, _ := cmd.Flags().GetString("subject"); subject == "" || cmd.Flags().Changed("output") {
+			output, _ := cmd.Flags().GetString("output")
+			if err := lib.SaveEnrollment(output, e); err != nil {
+				log.Fatalf("Error in Writing Enrollment: %v", err)
+			}
+			log.Println("Enrollment:\n", output)
+		}
+		log.Println("ID        :\n", e.ID)
+		log.Println("Public Key:\n", hex.EncodeToString(e.PublicKey))
+
+		// Revoke the old record only once its replacement is written
+		if revoked != nil {
+			revoked.ReplacedBy = e.ID
+			// The list is created by the first rotation into it
+			path, _ := cmd.Flags().GetString("revocations")
+			l, err := lib.LoadRevocations(path)
+			if errors.Is(err, os.ErrNotExist) {
+				l, err = &lib.RevocationList{}, nil
+			}
+			if err != nil {
+				log.Fatalf("Error in Reading Revocations: %v", err)
+			}
+			if err := l.Revoke(*revoked); err != nil {
+				log.Fatalf("Error in Rotation: %v", err)
+			}
+			if err := lib.SaveRevocations(path, l); err != nil {
+				log.Fatalf("Error in Writing Revocations: %v", err)
+			}
+			log.Println("Revoked   :\n", revoked.ID, hex.EncodeToString(revoked.PublicKey))
+		}
+	},
+}
+
+// rotation describes the revocation of the record at path. Records made
+// before they carried their public key are reproduced from the captures to
+// learn it.
+func rotation(cmd *cobra.Command, path string, captures []string) (*lib.Revocation, error) {
+	old, err := lib.LoadEnrollment(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := old.PublicKey
+	if len(pub) == 0 {
+		key, err := reproduceKey(cmd, captures, old)
+		if err != nil {
+			return nil, err
+		}
+		alg := ""
+		if old.Algorithm == "" {
+			alg, _ = cmd.Flags().GetString("alg")
+		}
+		signer, err := old.Signer(key, alg)
+		if err != nil {
+			return nil, err
+		}
+		pub = signer.PublicKey()
+	}
+
+	reason, _ := cmd.Flags().GetString("reason")
+	return &lib.Revocation{
+		ID:        old.ID,
+		PublicKey: pub,
+		RevokedAt: time.Now().UTC().Truncate(time.Second),
+		Reason:    reason,
+	}, nil
+}
+
+// loadRevocations reads the revocation list named by --revocations. Only the
+// default list may be missing, before anything was revoked; a list named on
+// the command line must exist.
+func loadRevocations(cmd *cobra.Command) *lib.RevocationList {
+	path, _ := cmd.Flags().GetString("revocations")
+	l, err := lib.LoadRevocations(path)
+	if errors.Is(err, os.ErrNotExist) && !cmd.Flags().Changed("revocations") {
+		return &lib.RevocationList{}
+	}
+	if err != nil {
+		log.Fatalf("Error in Reading Revocations: %v", err)
+	}
+	return l
+}
+
+func init() {
+	rootCmd.AddCommand(enrollCmd)
+	addSourceFlags(enrollCmd)
+	addEnrollFlags(enrollCmd)
+
+	enrollCmd.Flags().Bool("robust", false, "authenticate the helper data with a MAC keyed from the key")
+	enrollCmd.Flags().String("alg", lib.AlgEd25519, "signature algorithm of the enrolled key: ed25519, ecdsa-p256, bip340 or schnorr")
+	enrollCmd.Flags().String("rotate", "", "enrollment record to revoke and replace with this one")
+	enrollCmd.Flags().String("reason", "rotated", "reason recorded when revoking the rotated record")
+	enrollCmd.Flags().String("revocations", "revocations.json", "revocation list the rotated record is added to")
+	enrollCmd.Flags().String("recipient", "", "hex X25519 recipient key to seal the helpers to")
+	enrollCmd.Flags().String("subject", "", "subject to keep the record for in the enrollment store")
+	addStoreFlags(enrollCmd.Flags())
+	enrollCmd.Flags().StringP("output", "o", "enrollment.json", "enrollment record to write")
+}
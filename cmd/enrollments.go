@@ -0,0 +1,155 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/store"
+)
+
+// enrollmentsCmd represents the enrollments command
+var enrollmentsCmd = &cobra.Command{
+	Use:   "enrollments",
+	Short: "Manage the enrollment records of an enrollment store",
+	Long: `Lists, shows and deletes the records kept by subject in an enrollment store:
+a directory with one folder per subject, or a single BoltDB file with
+--store-backend bolt. Records are added with "gofze enroll --subject" and used
+with "gofze sign --subject". For example:
+
+  gofze enroll tc/103_6.jpg --subject alice
+  gofze enrollments list
+  gofze enrollments show alice -o enrollment.json
+  gofze enrollments delete alice <id>`,
+}
+
+var enrollmentsListCmd = &cobra.Command{
+	Use:   "list [subject]",
+	Short: "List the enrollments of every subject or of one",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := openStore(cmd)
+		defer s.Close()
+
+		subject := ""
+		if len(args) > 0 {
+			subject = args[0]
+		}
+		entries, err := s.List(subject)
+		if err != nil {
+			log.Fatalf("Error in Listing Enrollments: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SUBJECT\tID\tALGORITHM\tSTORED\tPUBLIC KEY")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Subject, e.ID, e.Algorithm, e.Stored.Format(time.RFC3339), hex.EncodeToString(e.PublicKey))
+		}
+		w.Flush()
+	},
+}
+
+var enrollmentsShowCmd = &cobra.Command{
+	Use:   "show <subject> [id]",
+	Short: "Print or export an enrollment, by default the last of the subject",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := openStore(cmd)
+		defer s.Close()
+
+		e, err := s.Get(args[0], optionalArg(args, 1))
+		if err != nil {
+			log.Fatalf("Error in Reading Enrollment: %v", err)
+		}
+
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			if err := lib.SaveEnrollment(output, e); err != nil {
+				log.Fatalf("Error in Writing Enrollment: %v", err)
+			}
+			log.Println("Enrollment:\n", output)
+			return
+		}
+		b, err := lib.MarshalEnrollment(e)
+		if err != nil {
+			log.Fatalf("Error in Reading Enrollment: %v", err)
+		}
+		fmt.Println(string(b))
+	},
+}
+
+var enrollmentsDeleteCmd = &cobra.Command{
+	Use:   "delete <subject> [id]",
+	Short: "Delete an enrollment, or every enrollment of a subject",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		s := openStore(cmd)
+		defer s.Close()
+
+		if err := s.Delete(args[0], optionalArg(args, 1)); err != nil {
+			log.Fatalf("Error in Deleting Enrollment: %v", err)
+		}
+		log.Println("Deleted   :\n", strings.Join(args, " "))
+	},
+}
+
+// optionalArg returns the i-th argument, or "" when it was not given.
+func optionalArg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// addStoreFlags adds the flags naming an enrollment store.
+func addStoreFlags(flags *pflag.FlagSet) {
+	flags.String("store", "enrollments", "enrollment store: a directory, or a database file with --store-backend bolt")
+	flags.String("store-backend", store.BackendFile, "enrollment store backend: file or bolt")
+}
+
+// openStore opens the enrollment store named by --store.
+func openStore(cmd *cobra.Command) store.EnrollmentStore {
+	path, _ := cmd.Flags().GetString("store")
+	backend, _ := cmd.Flags().GetString("store-backend")
+	s, err := store.Open(backend, path)
+	if err != nil {
+		log.Fatalf("Error in Opening Store: %v", err)
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(enrollmentsCmd)
+	enrollmentsCmd.AddCommand(enrollmentsListCmd, enrollmentsShowCmd, enrollmentsDeleteCmd)
+	addStoreFlags(enrollmentsCmd.PersistentFlags())
+
+	enrollmentsShowCmd.Flags().StringP("output", "o", "", "enrollment record to write instead of printing it")
+}
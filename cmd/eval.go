@@ -0,0 +1,111 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/eval"
+)
+
+// evalCmd represents the eval command
+var evalCmd = &cobra.Command{
+	Use:   "eval <dir>",
+	Short: "Measure false-accept and false-reject rates over a capture corpus",
+	Long: `Enrolls every capture in a directory and reproduces it from every other
+capture. Captures are grouped by subject from their <subject>_<n>.<ext> names,
+so pairs of the same subject are genuine attempts and all others impostors.
+
+The hamming and reproduce errors are swept over the given values, the rates of
+every operating point are printed and optionally written as CSV for DET and ROC
+plots, and the equal error rate is reported. For example:
+
+  gofze eval tc --hamming-errors 2,4,6 --reproduce-errors 0.01,0.001 --csv det.csv`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		samples, err := eval.LoadCorpus(args[0])
+		if err != nil {
+			log.Fatalf("Error in Reading Corpus: %v", err)
+		}
+
+		hammingErrors, _ := cmd.Flags().GetIntSlice("hamming-errors")
+		reproduceErrors, _ := cmd.Flags().GetFloat64Slice("reproduce-errors")
+		workers, _ := cmd.Flags().GetInt("workers")
+
+		e := sourceEnrollment(cmd)
+		if err := sizeMinutiae(e, samples[0].Path); err != nil {
+			log.Fatalf("Error in Biometric Source: %v", err)
+		}
+		results, err := eval.Run(samples, eval.Config{
+			Source: func(path string) lib.FeatureSource {
+				source, err := openSource(e, path)
+				if err != nil {
+					log.Fatalf("Error in Biometric Source: %v", err)
+				}
+				return source
+			},
+			Params:  eval.Grid(hammingErrors, reproduceErrors),
+			Workers: workers,
+		})
+		if err != nil {
+			log.Fatalf("Error in Evaluation: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "hamming error\treproduce error\tgenuine\timpostor\tFAR\tFRR")
+		for _, r := range results {
+			fmt.Fprintf(w, "%d\t%g\t%d\t%d\t%.4f\t%.4f\n", r.HammingError, r.ReproduceError, r.Genuine, r.Impostor, r.FAR, r.FRR)
+		}
+		w.Flush()
+
+		eer, closest := eval.EqualErrorRate(results)
+		fmt.Printf("failures to acquire: %d of %d captures\n", closest.FailuresToAcquire, len(samples))
+		fmt.Printf("equal error rate: %.4f (closest at hamming error %d, reproduce error %g)\n", eer, closest.HammingError, closest.ReproduceError)
+
+		if path, _ := cmd.Flags().GetString("csv"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				log.Fatalf("Error in Writing CSV: %v", err)
+			}
+			defer f.Close()
+			if err := eval.WriteCSV(f, results); err != nil {
+				log.Fatalf("Error in Writing CSV: %v", err)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(evalCmd)
+	addSourceFlags(evalCmd)
+
+	evalCmd.Flags().IntSlice("hamming-errors", []int{2, 4, 6}, "hamming errors to sweep")
+	evalCmd.Flags().Float64Slice("reproduce-errors", []float64{0.01, 0.001}, "reproduce errors to sweep")
+	evalCmd.Flags().Int("workers", 0, "parallel enrollments (default one per CPU)")
+	evalCmd.Flags().String("csv", "", "write the DET/ROC points to this CSV file")
+}
@@ -0,0 +1,262 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// addEnrollFlags registers the flags sizing the extractor and grouping captures
+// into fingers. They are shared by every command that reads a fingerprint.
+func addEnrollFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("hamming-error", 4, "bit errors the extractor is sized to tolerate")
+	cmd.Flags().StringArray("finger", nil, "comma separated captures of one finger, repeated once per finger (empty to skip a finger when reproducing)")
+	cmd.Flags().Int("threshold", 0, "fingers needed to reproduce the key (default all fingers)")
+	cmd.Flags().String("key-context", "", "context the derived signing, encryption and MAC keys are bound to")
+	cmd.Flags().String("password-file", "", "file whose first line is the password the helpers are sealed with")
+	cmd.Flags().String("identity", "", "file holding the hex X25519 identity the helpers are sealed to")
+}
+
+// credential reads the password or identity that opens sealed helpers.
+func credential(cmd *cobra.Command) (lib.Credential, error) {
+	c := lib.Credential{}
+	if path, _ := cmd.Flags().GetString("password-file"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		c.Password = []byte(strings.TrimSuffix(line, "\r"))
+	}
+	if path, _ := cmd.Flags().GetString("identity"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		if c.Identity, err = hex.DecodeString(strings.TrimSpace(string(b))); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// sealHelpers seals the helpers of a new enrollment with the password of
+// --password-file or to the --recipient key, if either is given.
+func sealHelpers(cmd *cobra.Command, e *lib.Enrollment) error {
+	c, err := credential(cmd)
+	if err != nil {
+		return err
+	}
+	recipient, _ := cmd.Flags().GetString("recipient")
+
+	switch {
+	case c.Password != nil && recipient != "":
+		return errors.New("seal with a password or to a recipient, not both")
+	case c.Password != nil:
+		e.Helpers, err = lib.SealPassword(e.Helpers, c.Password)
+	case recipient != "":
+		var pub []byte
+		if pub, err = hex.DecodeString(recipient); err == nil {
+			e.Helpers, err = lib.SealRecipient(e.Helpers, pub)
+		}
+	}
+	return err
+}
+
+// fingerCaptures groups biometric paths per finger: one finger per --finger
+// flag, or else every positional path as a capture of a single finger.
+func fingerCaptures(cmd *cobra.Command, paths []string) [][]string {
+	fingers, _ := cmd.Flags().GetStringArray("finger")
+	if len(fingers) == 0 {
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		return [][]string{paths}
+	}
+
+	captures := make([][]string, len(fingers))
+	for i, finger := range fingers {
+		captures[i] = strings.Split(finger, ",")
+	}
+	return captures
+}
+
+// enrollKey generates a key from the given captures. Several captures of one
+// finger are enrolled with their reliable bits only, and several fingers are
+// bound to one key with threshold reconstruction.
+func enrollKey(cmd *cobra.Command, paths []string) (lib.Key, *lib.Enrollment, error) {
+	e := sourceEnrollment(cmd)
+	e.HammingError, _ = cmd.Flags().GetInt("hamming-error")
+	context, _ := cmd.Flags().GetString("key-context")
+	e.Salt = lib.NewKeySalt()
+	e.Keys = lib.DefaultKeyLabels(context)
+	agreement, _ := cmd.Flags().GetFloat64("agreement")
+
+	fingers := fingerCaptures(cmd, paths)
+	for _, captures := range fingers {
+		if len(captures) > 1 {
+			e.Aligned = true
+		}
+	}
+
+	if err := sizeMinutiae(e, fingers[0][0]); err != nil {
+		return "", nil, err
+	}
+	if e.Length <= 0 || e.Length%4 != 0 {
+		return "", nil, errors.New("length must be a positive multiple of 4")
+	}
+	e.Robust, _ = cmd.Flags().GetBool("robust")
+	fe := e.Extractor()
+
+	keys := make([]lib.Key, len(fingers))
+	helpers := make([]*lib.Helpers[uint32], len(fingers))
+	for i, captures := range fingers {
+		var err error
+		if len(captures) > 1 {
+			// Multi-Sample Enrollment
+			sources := make([]lib.FeatureSource, len(captures))
+			for j, capture := range captures {
+				if capture == "" || capture == "-" {
+					return "", nil, errors.New("stdin can only provide a single sample")
+				}
+				if sources[j], err = openSource(e, capture); err != nil {
+					return "", nil, err
+				}
+			}
+			keys[i], helpers[i], err = lib.GenMultiSample(fe, sources, agreement)
+		} else {
+			var source lib.FeatureSource
+			var features []byte
+			if source, err = openSource(e, captures[0]); err != nil {
+				return "", nil, err
+			}
+			if features, err = source.Features(); err != nil {
+				return "", nil, err
+			}
+			keys[i], helpers[i], err = fe.Gen(hex.EncodeToString(features))
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	if len(fingers) == 1 {
+		b, err := helpers[0].MarshalBinary()
+		e.Helpers = b
+		return keys[0], e, err
+	}
+
+	// Multi-Finger Threshold Binding
+	threshold, _ := cmd.Flags().GetInt("threshold")
+	if threshold == 0 {
+		threshold = len(fingers)
+	}
+	key, th, err := lib.GenThreshold(threshold, keys, helpers)
+	if err != nil {
+		return "", nil, err
+	}
+	e.Fingers = len(fingers)
+	e.Threshold = threshold
+	e.Helpers, err = th.MarshalBinary()
+	return key, e, err
+}
+
+// reproduceKey reproduces the key of an enrollment from one capture per finger.
+func reproduceKey(cmd *cobra.Command, paths []string, e *lib.Enrollment) (lib.Key, error) {
+	if e.Length <= 0 || e.Length%4 != 0 {
+		return "", errors.New("enrollment has an invalid length")
+	}
+	fe := e.Extractor()
+
+	c, err := credential(cmd)
+	if err != nil {
+		return "", err
+	}
+	data, err := e.OpenHelpers(c)
+	if err != nil {
+		return "", err
+	}
+
+	fingers := fingerCaptures(cmd, paths)
+	for _, captures := range fingers {
+		if len(captures) != 1 {
+			return "", errors.New("expected a single capture per finger")
+		}
+	}
+
+	if e.Fingers == 0 {
+		if len(fingers) != 1 {
+			return "", errors.New("enrollment has a single finger")
+		}
+
+		helpers := &lib.Helpers[uint32]{}
+		if err := helpers.UnmarshalBinary(data); err != nil {
+			return "", err
+		}
+		source, err := openSource(e, fingers[0][0])
+		if err != nil {
+			return "", err
+		}
+		features, err := source.Features()
+		if err != nil {
+			return "", err
+		}
+		return fe.Rep(hex.EncodeToString(features), helpers)
+	}
+
+	th := &lib.ThresholdHelpers[uint32]{}
+	if err := th.UnmarshalBinary(data); err != nil {
+		return "", err
+	}
+	if len(fingers) != th.Fingers() {
+		return "", errors.New("expected one --finger flag per enrolled finger")
+	}
+
+	fes := make([]lib.FuzzyExtractor[uint32], len(fingers))
+	values := make([]string, len(fingers))
+	for i, captures := range fingers {
+		fes[i] = fe
+		if captures[0] == "" {
+			continue
+		}
+
+		source, err := openSource(e, captures[0])
+		if err != nil {
+			return "", err
+		}
+		features, err := source.Features()
+		if err != nil {
+			log.Printf("Skipping finger %d: %v", i+1, err)
+			continue
+		}
+		values[i] = hex.EncodeToString(features)
+	}
+	return lib.NewThresholdExtractor(fes, th.Threshold()).Rep(values, th)
+}
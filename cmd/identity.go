@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// identityCmd represents the identity command
+var identityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Generate an X25519 identity that enrollments can be sealed to",
+	Long: `Writes a new X25519 identity (private key) in hex and prints its recipient key.
+Enrollments sealed with "gofze enroll --recipient <key>" are then only usable
+together with "--identity <file>". For example:
+
+  gofze identity -o me.key`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		identity, recipient, err := lib.NewIdentity()
+		if err != nil {
+			log.Fatalf("Error in Identity: %v", err)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if err := os.WriteFile(output, []byte(hex.EncodeToString(identity)+"\n"), 0o600); err != nil {
+			log.Fatalf("Error in Writing Identity: %v", err)
+		}
+		log.Println("Identity  :\n", output)
+		log.Println("Recipient :\n", hex.EncodeToString(recipient))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(identityCmd)
+
+	identityCmd.Flags().StringP("output", "o", "identity.key", "identity file to write")
+}
@@ -0,0 +1,172 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	"github.com/nart4hire/gofze/lib/rest"
+	"github.com/nart4hire/gofze/lib/rpc"
+	"github.com/nart4hire/gofze/lib/rpc/gofzepb"
+	"github.com/nart4hire/gofze/lib/service"
+	"github.com/nart4hire/gofze/lib/store"
+	"github.com/nart4hire/gofze/lib/tsa"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve enroll, sign and verify as a JSON API over HTTP and over gRPC",
+	Long: `Serves enrollment, signing and verification to applications over HTTP, taking
+multipart forms and answering JSON, with errors as {"error": {"code", "message"}}:
+
+  POST /v1/enroll   capture [subject source minutiae length hammingError ...]
+  POST /v1/sign     capture document (enrollment | subject) [password identity]
+  POST /v1/verify   document signature [publicKey]
+  GET  /healthz
+
+Records enrolled for a subject are kept in the --store, and signatures by keys
+in the --revocations list are rejected, unless a timestamp from an authority of
+--tsa-cert shows they were made before the revocation. Requests over
+--max-request bytes are refused, and on SIGINT or SIGTERM the server stops
+accepting connections and finishes the requests in flight.
+
+With --grpc-addr the gofze.v1.GofzeService of lib/rpc/proto is served as well,
+taking captures and documents in chunks and streaming the progress of
+enrollments. For example:
+
+  gofze serve --addr :8080 --grpc-addr :9090
+  curl -F capture=@tc/103_6.jpg -F subject=alice localhost:8080/v1/enroll`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		svc := &service.Service{}
+		svc.Revocations, _ = cmd.Flags().GetString("revocations")
+		if cmd.Flags().Changed("revocations") {
+			loadRevocations(cmd)
+		}
+		if path, _ := cmd.Flags().GetString("tsa-cert"); path != "" {
+			roots, err := tsa.LoadCertPool(path)
+			if err != nil {
+				log.Fatalf("Error in Reading Certificate: %v", err)
+			}
+			svc.TSARoots = roots
+		}
+		if path, _ := cmd.Flags().GetString("store"); path != "" {
+			backend, _ := cmd.Flags().GetString("store-backend")
+			s, err := store.Open(backend, path)
+			if err != nil {
+				log.Fatalf("Error in Opening Store: %v", err)
+			}
+			defer s.Close()
+			svc.Store = s
+		}
+
+		addr, _ := cmd.Flags().GetString("addr")
+		maxRequest, _ := cmd.Flags().GetInt64("max-request")
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           rest.NewHandler(svc, maxRequest),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		errs := make(chan error, 2)
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+		log.Println("Listening :\n", addr)
+
+		var grpcServer *grpc.Server
+		if grpcAddr, _ := cmd.Flags().GetString("grpc-addr"); grpcAddr != "" {
+			lis, err := net.Listen("tcp", grpcAddr)
+			if err != nil {
+				log.Fatalf("Error in Listening: %v", err)
+			}
+			grpcServer = grpc.NewServer()
+			gofzepb.RegisterGofzeServiceServer(grpcServer, rpc.NewServer(svc))
+			go func() {
+				if err := grpcServer.Serve(lis); err != nil {
+					errs <- err
+				}
+			}()
+			log.Println("gRPC      :\n", grpcAddr)
+		}
+
+		select {
+		case err := <-errs:
+			log.Fatalf("Error in Serving: %v", err)
+		case <-ctx.Done():
+		}
+
+		// Drain the requests in flight before closing the store
+		timeout, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		shutdown, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		stopped := make(chan struct{})
+		if grpcServer != nil {
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			go func() {
+				// Cut the streams still open at the deadline
+				<-shutdown.Done()
+				grpcServer.Stop()
+			}()
+		} else {
+			close(stopped)
+		}
+		if err := server.Shutdown(shutdown); err != nil {
+			log.Printf("Error in Shutdown: %v", err)
+		}
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error in Serving: %v", err)
+		}
+		<-stopped
+		log.Println("Stopped")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().String("addr", "localhost:8080", "address to listen on")
+	serveCmd.Flags().String("grpc-addr", "", "address to serve gRPC on, none when empty")
+	serveCmd.Flags().Int64("max-request", rest.DefaultMaxRequest, "largest request body accepted, in bytes")
+	serveCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "time given to requests in flight when stopping")
+	serveCmd.Flags().String("revocations", "revocations.json", "revocation list of enrollments that may not sign or be trusted")
+	serveCmd.Flags().String("tsa-cert", "", "trusted timestamp authority certificates (PEM bundle or DER)")
+	addStoreFlags(serveCmd.Flags())
+}
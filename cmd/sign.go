@@ -22,96 +22,374 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/binary"
+	"bufio"
 	"encoding/hex"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/nart4hire/fingerprints/lib/extraction"
-	"github.com/nart4hire/fingerprints/lib/helpers"
-	"github.com/nart4hire/goschnorr"
 	"github.com/spf13/cobra"
 
 	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/batch"
+	"github.com/nart4hire/gofze/lib/cms"
+	"github.com/nart4hire/gofze/lib/merkle"
+	"github.com/nart4hire/gofze/lib/pdf"
+	"github.com/nart4hire/gofze/lib/tsa"
 )
 
 // signCmd represents the sign command
 var signCmd = &cobra.Command{
-	Use:   "sign",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:   "sign <file|-> [image|template]...",
+	Short: "Sign a file with a key reproduced from biometric captures",
+	Long: `Reproduces the biometric key, derives its signing key and writes a detached
+signature bundle recording the algorithm, digest, public key and signature. The
+document is hashed as a stream, and read from stdin when given as "-" (with
+--output). The bundle also signs the signing time, signer label, content type,
+file name, gofze version and a hash of the extractor parameters, and --tsa adds
+an RFC 3161 timestamp token over the signature. For example:
+
+  gofze sign tc/test.pdf tc/103_7.jpg --enrollment enrollment.json
+
+Document systems that need a detached CMS (PKCS #7) signature pass --format cms
+or cms-pem, with the ed25519 or ecdsa-p256 algorithm, and --pdf embeds the CMS
+signature in a copy of a PDF. Enrollments sign with the algorithm they were
+enrolled with; --alg only applies when the captures are enrolled on the fly.
+Signatures are checked with "gofze verify".
+
+With --batch the key is reproduced once and every document of a directory, or
+of a list with one path per line, is signed in parallel. Each gets a <file>.sig
+bundle and a summary manifest (gofze-batch.json) lists them all:
+
+  gofze sign --batch release/ tc/103_7.jpg --enrollment enrollment.json
+
+With --merkle a whole directory tree is signed with one signature over the root
+of a Merkle tree of its files, written to gofze-merkle.json, and every file gets
+a <file>.proof that checks it against the signed root on its own.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// A batch or tree takes its documents from a flag, leaving only captures
+		batch, _ := cmd.Flags().GetString("batch")
+		tree, _ := cmd.Flags().GetString("merkle")
+		if batch != "" || tree != "" {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		// Read File to be signed
-		b, err := os.ReadFile(args[0])
+		output, _ := cmd.Flags().GetString("output")
+		if path, _ := cmd.Flags().GetString("batch"); path != "" {
+			signBatch(cmd, path, output, args)
+			return
+		}
+		if dir, _ := cmd.Flags().GetString("merkle"); dir != "" {
+			signTree(cmd, dir, output, args)
+			return
+		}
+
+		// Stdin can carry the document or a capture, not both
+		if args[0] == "-" {
+			for _, captures := range fingerCaptures(cmd, args[1:]) {
+				for _, capture := range captures {
+					if capture == "" || capture == "-" {
+						log.Fatalf("Error in Reading File: %v", "stdin cannot hold both the document and a capture")
+					}
+				}
+			}
+			if output == "" {
+				log.Fatalf("Error in Reading File: %v", "--output is required when signing stdin")
+			}
+		}
+
+		signer, e := newSigner(cmd, args[1:])
+
+		// Stream the File to be signed
+		document, err := openDocument(args[0])
 		if err != nil {
 			log.Fatalf("Error in Reading File: %v", err)
 		}
+		defer document.Close()
 
-		// Read & Process Biometric Image
-		_, m := helpers.LoadImage(args[1])
-		minutiae := extraction.DetectionResult(m)
-		minutiaeUint32 := make([]uint32, len(minutiae.Minutia))
-		for i := range minutiae.Minutia {
-			minutia := lib.NewMinutia(&minutiae.Minutia[i])
-			minutiaeUint32[i] = minutia.GetBuffer()
+		format, _ := cmd.Flags().GetString("format")
+		if embed, _ := cmd.Flags().GetBool("pdf"); embed {
+			format = "pdf"
+		}
+		switch format {
+		case "pdf":
+			// An incremental update needs the whole document
+			b, err := io.ReadAll(document)
+			if err != nil {
+				log.Fatalf("Error in Reading File: %v", err)
+			}
+			signed, err := pdf.Sign(b, signer)
+			if err != nil {
+				log.Fatalf("Error in Sign: %v", err)
+			}
+			if output == "" {
+				output = strings.TrimSuffix(args[0], ".pdf") + ".signed.pdf"
+			}
+			if err := os.WriteFile(output, signed, 0o644); err != nil {
+				log.Fatalf("Error in Writing Signature: %v", err)
+			}
+		case "bundle":
+			digest, _ := cmd.Flags().GetString("digest")
+			content := bufio.NewReader(document)
+			sb, err := lib.SignReaderWithAttributes(signer, digest, content, attributes(cmd, args[0], content, signer, e))
+			if err != nil {
+				log.Fatalf("Error in Sign: %v", err)
+			}
+			if url, _ := cmd.Flags().GetString("tsa"); url != "" {
+				if sb.Timestamp, err = tsa.Timestamp(url, sb.Signature); err != nil {
+					log.Fatalf("Error in Timestamp: %v", err)
+				}
+			}
+			if output == "" {
+				output = args[0] + ".sig"
+			}
+			if err := lib.SaveSignature(output, sb); err != nil {
+				log.Fatalf("Error in Writing Signature: %v", err)
+			}
+		case "cms", "cms-pem":
+			der, err := cms.SignReader(signer, document)
+			if err != nil {
+				log.Fatalf("Error in Sign: %v", err)
+			}
+			if format == "cms-pem" {
+				der = cms.EncodePEM(der)
+			}
+			if output == "" {
+				output = args[0] + ".p7s"
+			}
+			if err := os.WriteFile(output, der, 0o644); err != nil {
+				log.Fatalf("Error in Writing Signature: %v", err)
+			}
+		default:
+			log.Fatalf("Error in Sign: unknown format %s", format)
 		}
-		minutiaeBytes := new(bytes.Buffer)
-		binary.Write(minutiaeBytes, binary.BigEndian, &minutiaeUint32)
-		minutiaeHex := hex.EncodeToString(minutiaeBytes.Bytes())
-		log.Println("Minutiae  :\n", minutiaeHex)
-
-		// Minutiae Fuzzy Extraction
-		fe := lib.NewDefaultFuzzy32Extractor(len(minutiaeUint32), 4)
-		key, helpers, err := fe.Gen(minutiaeHex)
+
+		log.Println("Algorithm :\n", signer.Algorithm())
+		log.Println("Public Key:\n", hex.EncodeToString(signer.PublicKey()))
+		log.Println("Signature :\n", output)
+	},
+}
+
+// newSigner reproduces the key from the captures, or enrolls them when no
+// enrollment is given, and derives the signer of the enrolled algorithm.
+func newSigner(cmd *cobra.Command, captures []string) (lib.Signer, *lib.Enrollment) {
+	// Reproduce or Enroll Biometric Key
+	var key lib.Key
+	var e *lib.Enrollment
+	var err error
+	path, _ := cmd.Flags().GetString("enrollment")
+	subject, _ := cmd.Flags().GetString("subject")
+	if path != "" || subject != "" {
+		e = readEnrollment(cmd)
+		key, err = reproduceKey(cmd, captures, e)
 		if err != nil {
 			log.Fatalf("Error in Fuzzy Extraction: %v", err)
 		}
-		log.Println("Key       :\n", key)
-		log.Println("Helpers   :\n", helpers)
-
-		keyBytes, err := hex.DecodeString(string(key))
+	} else {
+		key, e, err = enrollKey(cmd, captures)
 		if err != nil {
-			log.Fatalf("Error in Hex Decode: %v", err)
+			log.Fatalf("Error in Fuzzy Extraction: %v", err)
 		}
+	}
 
-		keyHash := sha256.Sum256(keyBytes)
+	// Records with a public key sign with their enrolled algorithm only
+	alg := ""
+	if cmd.Flags().Changed("alg") || len(e.PublicKey) == 0 {
+		alg, _ = cmd.Flags().GetString("alg")
+	}
+	signer, err := e.Signer(key, alg)
+	if err != nil {
+		log.Fatalf("Error in Signer: %v", err)
+	}
+	if path != "" || subject != "" {
+		refuseRevoked(cmd, e.ID, signer.PublicKey())
+	}
+	return signer, e
+}
 
-		// Use as Scnorr Private Key
-		s, err := schnorr.NewSchnorr(rand.Reader, sha256.New())
-		if err != nil {
-			log.Fatalf("Error in Schnorr Library: %v", err)
+// attributes describes a signature of the document at path, detecting its
+// content type from the first bytes unless --content-type is given.
+func attributes(cmd *cobra.Command, path string, content *bufio.Reader, signer lib.Signer, e *lib.Enrollment) *lib.Attributes {
+	contentType, _ := cmd.Flags().GetString("content-type")
+	if contentType == "" {
+		head, _ := content.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+
+	// Without a label the signer is named by its key
+	signerID, _ := cmd.Flags().GetString("signer")
+	if signerID == "" {
+		signerID = lib.KeyID(signer.PublicKey())
+	}
+
+	filename := ""
+	if path != "-" {
+		filename = filepath.Base(path)
+	}
+
+	return &lib.Attributes{
+		SigningTime: time.Now().UTC(),
+		SignerID:    signerID,
+		ContentType: contentType,
+		Filename:    filename,
+		Version:     lib.Version(),
+		ParamsHash:  e.ParamsHash(),
+	}
+}
+
+// signBatch signs every document of a directory or list with one reproduction
+// of the key and writes the summary manifest.
+func signBatch(cmd *cobra.Command, path, output string, captures []string) {
+	if format, _ := cmd.Flags().GetString("format"); format != "bundle" {
+		log.Fatalf("Error in Sign: %v", "batches are signed as bundles")
+	}
+
+	files, err := batch.Files(path)
+	if err != nil {
+		log.Fatalf("Error in Reading Batch: %v", err)
+	}
+
+	signer, _ := newSigner(cmd, captures)
+
+	digest, _ := cmd.Flags().GetString("digest")
+	workers, _ := cmd.Flags().GetInt("workers")
+	m, err := batch.Sign(signer, digest, files, workers)
+	if err != nil {
+		log.Fatalf("Error in Sign: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("Error in Reading Batch: %v", err)
+	}
+	if output == "" {
+		output = filepath.Join(path, batch.ManifestName)
+		if !info.IsDir() {
+			output = filepath.Join(filepath.Dir(path), batch.ManifestName)
 		}
+	}
+	// Documents added to a signed directory are flagged on verification
+	m.Directory = info.IsDir() && filepath.Clean(filepath.Dir(output)) == filepath.Clean(path)
+	if err := batch.SaveManifest(output, m, signer); err != nil {
+		log.Fatalf("Error in Writing Manifest: %v", err)
+	}
 
-		pub, err := s.GenFromPriv(keyHash[:])
-		if err != nil {
-			log.Fatalf("Error in GenerateKeyPair: %v", err)
+	for _, entry := range m.Entries {
+		if entry.Error != "" {
+			log.Println("Failed    :", entry.File, entry.Error)
 		}
+	}
+	log.Println("Algorithm :\n", signer.Algorithm())
+	log.Println("Public Key:\n", hex.EncodeToString(signer.PublicKey()))
+	log.Println("Manifest  :\n", output)
+	log.Printf("Signed    : %d of %d documents", len(m.Entries)-m.Failed(), len(m.Entries))
+	if m.Failed() > 0 {
+		log.Fatalf("Error in Sign: %d documents failed", m.Failed())
+	}
+}
 
-		sig, hash, err := s.Sign(keyHash[:], string(b))
-		if err != nil {
-			log.Fatalf("Error in Sign: %v", err)
+// signTree signs the Merkle root of a directory with one signature and writes
+// an inclusion proof next to every file.
+func signTree(cmd *cobra.Command, dir, output string, captures []string) {
+	tree, err := merkle.Build(dir)
+	if err != nil {
+		log.Fatalf("Error in Reading Directory: %v", err)
+	}
+
+	signer, _ := newSigner(cmd, captures)
+	sr, err := merkle.Sign(signer, tree)
+	if err != nil {
+		log.Fatalf("Error in Sign: %v", err)
+	}
+
+	if output == "" {
+		output = filepath.Join(dir, merkle.RootName)
+	}
+	if err := merkle.SaveRoot(output, sr); err != nil {
+		log.Fatalf("Error in Writing Signature: %v", err)
+	}
+	for _, p := range tree.Proofs(sr) {
+		path := filepath.Join(dir, filepath.FromSlash(p.Path)) + merkle.ProofSuffix
+		if err := merkle.SaveProof(path, p); err != nil {
+			log.Fatalf("Error in Writing Proof: %v", err)
 		}
+	}
 
-		p, q, g := s.GetParams()
-		log.Println("P         :\n", p)
-		log.Println("Q         :\n", q)
-		log.Println("G         :\n", g)
-		log.Println("Signature :\n", sig)
-		log.Println("Hash      :\n", hash)
-		log.Println("Public Key:\n", pub)
-	},
+	log.Println("Algorithm :\n", signer.Algorithm())
+	log.Println("Public Key:\n", hex.EncodeToString(signer.PublicKey()))
+	log.Println("Root      :\n", hex.EncodeToString(sr.Root))
+	log.Println("Signature :\n", output)
+	log.Printf("Proofs    : %d files", sr.Size)
+}
+
+// readEnrollment reads the record named by --subject from the store, or else
+// by --enrollment, refusing records that were revoked.
+func readEnrollment(cmd *cobra.Command) *lib.Enrollment {
+	var e *lib.Enrollment
+	var err error
+	if subject, _ := cmd.Flags().GetString("subject"); subject != "" {
+		s := openStore(cmd)
+		e, err = s.Get(subject, "")
+		s.Close()
+	} else {
+		path, _ := cmd.Flags().GetString("enrollment")
+		e, err = lib.LoadEnrollment(path)
+	}
+	if err != nil {
+		log.Fatalf("Error in Reading Enrollment: %v", err)
+	}
+	refuseRevoked(cmd, e.ID, e.PublicKey)
+	return e
+}
+
+// refuseRevoked stops when the enrollment or the key it signs with is in the
+// --revocations list. Records without a public key are checked again once
+// their signer is derived.
+func refuseRevoked(cmd *cobra.Command, id string, pub []byte) {
+	l := loadRevocations(cmd)
+	r := l.Lookup(id)
+	if r == nil {
+		r = l.LookupKey(pub)
+	}
+	if r != nil {
+		log.Fatalf("Error in Reading Enrollment: enrollment %s was revoked at %s", r.ID, r.RevokedAt.Format(time.RFC3339))
+	}
+}
+
+// openDocument opens the document to sign or verify, "-" being stdin.
+func openDocument(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
 }
 
 func init() {
 	rootCmd.AddCommand(signCmd)
+	addSourceFlags(signCmd)
+	addEnrollFlags(signCmd)
+
+	signCmd.Flags().String("enrollment", "", "enrollment record to reproduce the key from (enrolls on the fly if empty)")
+	signCmd.Flags().String("subject", "", "subject whose last enrollment in the store the key is reproduced from")
+	addStoreFlags(signCmd.Flags())
+	signCmd.Flags().String("alg", lib.AlgEd25519, "signature algorithm when enrolling on the fly, else the enrolled one: ed25519, ecdsa-p256, bip340 or schnorr")
+	signCmd.Flags().String("format", "bundle", "signature format: bundle (JSON), cms (DER) or cms-pem")
+	signCmd.Flags().String("digest", lib.DigestSHA256, "digest the document is streamed through for bundles: sha256 or sha512")
+	signCmd.Flags().String("batch", "", "sign every document of a directory or of a list with one path per line")
+	signCmd.Flags().String("merkle", "", "sign the Merkle root of a directory and write an inclusion proof per file")
+	signCmd.Flags().Int("workers", 0, "parallel signatures in a batch (default one per CPU)")
+	signCmd.Flags().String("signer", "", "signer label recorded in the bundle (default the key ID)")
+	signCmd.Flags().String("content-type", "", "content type recorded in the bundle (default detected)")
+	signCmd.Flags().String("revocations", "revocations.json", "revocation list refusing revoked enrollments")
+	signCmd.Flags().String("tsa", "", "RFC 3161 timestamp authority URL to timestamp the bundle signature")
+	signCmd.Flags().Bool("pdf", false, "embed a CMS signature in the PDF instead of writing a detached one")
+	signCmd.Flags().StringP("output", "o", "", "signature to write (default <file>.sig, <file>.p7s for CMS or <file>.signed.pdf)")
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 Nathanael
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// addSourceFlags registers the flags selecting where biometric features come from.
+func addSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().String("source", "fingerprint", "biometric source: fingerprint, template or hex")
+	cmd.Flags().Int("minutiae", lib.DefaultMinutiae, "number of minutiae packed from a fingerprint image (default every detected minutia)")
+	cmd.Flags().Int("length", 0, "template length in bytes for the template and hex sources")
+	cmd.Flags().Bool("align", false, "align fingerprint minutiae to the detected frame")
+	cmd.Flags().Float64("agreement", lib.DefaultAgreement, "fraction of samples that must agree on a reliable bit")
+}
+
+// sourceEnrollment starts an enrollment record describing the selected source,
+// so the same source can be set up again when the key is reproduced.
+func sourceEnrollment(cmd *cobra.Command) *lib.Enrollment {
+	source, _ := cmd.Flags().GetString("source")
+	minutiae, _ := cmd.Flags().GetInt("minutiae")
+	length, _ := cmd.Flags().GetInt("length")
+	aligned, _ := cmd.Flags().GetBool("align")
+
+	e := &lib.Enrollment{
+		Source:  source,
+		Length:  length,
+		Aligned: aligned,
+	}
+	if source == "fingerprint" {
+		e.Minutiae = minutiae
+		e.Length = minutiae * 4
+	}
+	return e
+}
+
+// sizeMinutiae counts the minutiae of the capture at path for a fingerprint
+// enrollment packing every detected minutia, so its other captures and later
+// readings are packed to the same length.
+func sizeMinutiae(e *lib.Enrollment, path string) error {
+	if e.Source != "fingerprint" || e.Minutiae != lib.DefaultMinutiae {
+		return nil
+	}
+	source, err := openSource(e, path)
+	if err != nil {
+		return err
+	}
+	features, err := source.Features()
+	if err != nil {
+		return err
+	}
+	e.Minutiae = len(features) / 4
+	e.Length = len(features)
+	return nil
+}
+
+// newFeatureSource builds the FeatureSource selected by the source flags.
+// The hex source reads stdin when path is empty or "-".
+func newFeatureSource(cmd *cobra.Command, path string) (lib.FeatureSource, error) {
+	return openSource(sourceEnrollment(cmd), path)
+}
+
+// openSource builds the FeatureSource described by an enrollment record.
+func openSource(e *lib.Enrollment, path string) (lib.FeatureSource, error) {
+	switch e.Source {
+	case "fingerprint":
+		if path == "" {
+			return nil, errors.New("missing fingerprint image")
+		}
+		if e.Aligned {
+			return lib.NewAlignedFingerprintSource(path, e.Minutiae), nil
+		}
+		return lib.NewFingerprintSource(path, e.Minutiae), nil
+	case "template":
+		if path == "" {
+			return nil, errors.New("missing template file")
+		}
+		return lib.NewTemplateSource(path, e.Length), nil
+	case "hex":
+		if path == "" || path == "-" {
+			return lib.NewHexSource(os.Stdin, e.Length), nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return lib.NewHexSource(bytes.NewReader(b), e.Length), nil
+	default:
+		return nil, errors.New("unknown biometric source: " + e.Source)
+	}
+}
@@ -22,37 +22,295 @@ THE SOFTWARE.
 package cmd
 
 import (
-	// "fmt"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
 
-	// "github.com/nart4hire/goschnorr"
 	"github.com/spf13/cobra"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/batch"
+	"github.com/nart4hire/gofze/lib/cms"
+	"github.com/nart4hire/gofze/lib/merkle"
+	"github.com/nart4hire/gofze/lib/pdf"
+	"github.com/nart4hire/gofze/lib/tsa"
 )
 
 // verifyCmd represents the verify command
 var verifyCmd = &cobra.Command{
-	Use:   "verify",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Use:   "verify <file|-> [signature]",
+	Short: "Verify a signature bundle written by sign",
+	Long: `Checks the detached signature of a file, either a signature bundle or a CMS
+signature in DER or PEM, against the public key it carries. With --pdf the
+signature embedded in the PDF itself is checked instead. The file is hashed as a
+stream and read from stdin when given as "-", in which case the signature must be
+named. Pass --public-key to also require the bundle to be signed by a known key.
+Signatures by keys in the --revocations list are rejected, unless a timestamp
+from an authority pinned with --tsa-cert shows they were made before the
+revocation.
+
+With --batch the signature of a manifest written by "sign --batch" is checked,
+then every document it lists in parallel, each reported as PASS or FAIL; files
+of a signed directory missing from the manifest FAIL too. With --merkle a file
+is checked against its <file>.proof, which must name it by its path relative
+to the signed directory given with --root, or a directory against its signed
+gofze-merkle.json root. For example:
+
+  gofze verify tc/test.pdf tc/test.pdf.sig --public-key <hex>`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if batch, _ := cmd.Flags().GetString("batch"); batch != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		// A tree may be given its proof or root
+		if tree, _ := cmd.Flags().GetString("merkle"); tree != "" {
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		// s := schnorr.NewSchnorr()
+		if path, _ := cmd.Flags().GetString("batch"); path != "" {
+			verifyBatch(cmd, path)
+			return
+		}
+		if path, _ := cmd.Flags().GetString("merkle"); path != "" {
+			verifyTree(cmd, path, args)
+			return
+		}
+
+		document, err := openDocument(args[0])
+		if err != nil {
+			log.Fatalf("Error in Reading File: %v", err)
+		}
+		defer document.Close()
+
+		// Embedded PDF, Detached CMS or Signature Bundle
+		var alg string
+		var pub []byte
+		var signedAt time.Time
+		path := args[0] + ".sig"
+		if len(args) > 1 {
+			path = args[1]
+		}
+		var sig []byte
+		if embedded, _ := cmd.Flags().GetBool("pdf"); !embedded {
+			if args[0] == "-" && len(args) < 2 {
+				log.Fatalf("Error in Reading Signature: %v", "a signature is required when verifying stdin")
+			}
+			sig, err = os.ReadFile(path)
+			if err != nil {
+				log.Fatalf("Error in Reading Signature: %v", err)
+			}
+		}
+
+		if sig == nil {
+			b, err := io.ReadAll(document)
+			if err != nil {
+				log.Fatalf("Error in Reading File: %v", err)
+			}
+			cert, err := pdf.Verify(b)
+			if err != nil {
+				log.Fatalf("Error in Verify: %v", err)
+			}
+			if pub, err = cms.PublicKey(cert); err != nil {
+				log.Fatalf("Error in Verify: %v", err)
+			}
+			alg = cert.PublicKeyAlgorithm.String()
+		} else if cms.IsCMS(sig) {
+			cert, err := cms.VerifyReader(sig, document)
+			if err != nil {
+				log.Fatalf("Error in Verify: %v", err)
+			}
+			if pub, err = cms.PublicKey(cert); err != nil {
+				log.Fatalf("Error in Verify: %v", err)
+			}
+			alg = cert.PublicKeyAlgorithm.String()
+		} else {
+			sb, err := lib.LoadSignature(path)
+			if err != nil {
+				log.Fatalf("Error in Reading Signature: %v", err)
+			}
+			if err := sb.VerifyReader(document); err != nil {
+				log.Fatalf("Error in Verify: %v", err)
+			}
+			alg, pub = sb.Algorithm, sb.PublicKey
+
+			if a := sb.Attributes; a != nil {
+				log.Println("Signed At :\n", a.SigningTime.Format(time.RFC3339))
+				log.Println("Signer    :\n", a.SignerID)
+				log.Println("Content   :\n", a.ContentType, a.Filename)
+				log.Println("Version   :\n", a.Version)
+				log.Println("Parameters:\n", hex.EncodeToString(a.ParamsHash))
+			}
+			if sb.Timestamp != nil {
+				signedAt = verifyTimestamp(cmd, sb)
+			}
+		}
+
+		checkKey(cmd, pub, signedAt)
+
+		log.Println("Algorithm :\n", alg)
+		log.Println("Public Key:\n", hex.EncodeToString(pub))
+		log.Println("Signature : valid")
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(verifyCmd)
+// checkKey requires, with --public-key, that pub is that key, and that pub was
+// not revoked. A key revoked after signedAt, the time of a timestamp from a
+// pinned authority, is only reported, since the signature predates its
+// revocation; signedAt is zero for timestamps of any other authority.
+func checkKey(cmd *cobra.Command, pub []byte, signedAt time.Time) {
+	if expected, _ := cmd.Flags().GetString("public-key"); expected != "" {
+		k, err := hex.DecodeString(expected)
+		if err != nil {
+			log.Fatalf("Error in Hex Decode: %v", err)
+		}
+		if !bytes.Equal(k, pub) {
+			log.Fatalf("Error in Verify: %v", "signed by another key")
+		}
+	}
+
+	r := loadRevocations(cmd).LookupKey(pub)
+	if r == nil {
+		return
+	}
+	revoked := fmt.Sprintf("%s at %s (%s)", r.ID, r.RevokedAt.Format(time.RFC3339), r.Reason)
+	if signedAt.IsZero() || !signedAt.Before(r.RevokedAt) {
+		log.Fatalf("Error in Verify: signed by revoked enrollment %s", revoked)
+	}
+	log.Println("Revoked   :\n", revoked, "after signing")
+}
+
+// verifyTimestamp checks the RFC 3161 token of a bundle and returns the time
+// it attests when it was issued by an authority of --tsa-cert. Tokens of other
+// authorities may be self-issued, so their time is zero.
+func verifyTimestamp(cmd *cobra.Command, sb *lib.SignatureBundle) time.Time {
+	info, err := tsa.Verify(sb.Timestamp, sb.Signature)
+	if err != nil {
+		log.Fatalf("Error in Timestamp: %v", err)
+	}
 
-	// Here you will define your flags and configuration settings.
+	path, _ := cmd.Flags().GetString("tsa-cert")
+	if path == "" {
+		log.Println("Timestamp :\n", info.Time.Format(time.RFC3339), "by", info.Certificate.Subject, "(untrusted, no --tsa-cert)")
+		return time.Time{}
+	}
+	roots, err := tsa.LoadCertPool(path)
+	if err != nil {
+		log.Fatalf("Error in Reading Certificate: %v", err)
+	}
+	if err := info.Trusted(roots); err != nil {
+		log.Fatalf("Error in Timestamp: issued by an untrusted authority: %v", err)
+	}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// verifyCmd.PersistentFlags().String("foo", "", "A help for foo")
+	log.Println("Timestamp :\n", info.Time.Format(time.RFC3339), "by", info.Certificate.Subject)
+	return info.Time
+}
+
+// verifyTree checks a file against its inclusion proof, or a whole directory
+// against its signed root.
+func verifyTree(cmd *cobra.Command, target string, args []string) {
+	info, err := os.Stat(target)
+	if err != nil {
+		log.Fatalf("Error in Reading File: %v", err)
+	}
+
+	var sr *merkle.SignedRoot
+	if info.IsDir() {
+		path := filepath.Join(target, merkle.RootName)
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if sr, err = merkle.LoadRoot(path); err != nil {
+			log.Fatalf("Error in Reading Signature: %v", err)
+		}
+		tree, err := merkle.Build(target)
+		if err != nil {
+			log.Fatalf("Error in Reading Directory: %v", err)
+		}
+		if err := sr.VerifyTree(tree); err != nil {
+			log.Fatalf("Error in Verify: %v", err)
+		}
+	} else {
+		path := target + merkle.ProofSuffix
+		if len(args) > 0 {
+			path = args[0]
+		}
+		root, _ := cmd.Flags().GetString("root")
+		if root == "" {
+			log.Fatalf("Error in Verify: --root must name the directory the file was signed in")
+		}
+		p, err := merkle.LoadProof(path)
+		if err != nil {
+			log.Fatalf("Error in Reading Signature: %v", err)
+		}
+		if err := p.VerifyFile(root, target); err != nil {
+			log.Fatalf("Error in Verify: %v", err)
+		}
+		log.Println("Path      :\n", p.Path)
+		sr = p.Root
+	}
+
+	checkKey(cmd, sr.Signature.PublicKey, time.Time{})
+
+	log.Println("Algorithm :\n", sr.Signature.Algorithm)
+	log.Println("Public Key:\n", hex.EncodeToString(sr.Signature.PublicKey))
+	log.Println("Root      :\n", hex.EncodeToString(sr.Root))
+	log.Println("Signature : valid")
+}
+
+// verifyBatch checks every document of a manifest written by sign --batch and
+// reports each one, along with documents of its directory it does not list.
+func verifyBatch(cmd *cobra.Command, path string) {
+	m, err := batch.LoadManifest(path)
+	if err != nil {
+		log.Fatalf("Error in Reading Manifest: %v", err)
+	}
+
+	checkKey(cmd, m.PublicKey, time.Time{})
+
+	workers, _ := cmd.Flags().GetInt("workers")
+	failed := 0
+	for _, r := range batch.Verify(m, workers) {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("FAIL %s: %v\n", r.File, r.Err)
+		} else {
+			fmt.Printf("PASS %s\n", r.File)
+		}
+	}
+	unlisted, err := batch.Unlisted(path, m)
+	if err != nil {
+		log.Fatalf("Error in Reading Batch: %v", err)
+	}
+	for _, file := range unlisted {
+		fmt.Printf("FAIL %s: not listed in the manifest\n", file)
+	}
+
+	log.Println("Algorithm :\n", m.Algorithm)
+	log.Println("Public Key:\n", hex.EncodeToString(m.PublicKey))
+	if len(unlisted) > 0 {
+		log.Fatalf("Error in Verify: %d documents are not in the manifest", len(unlisted))
+	}
+	if failed > 0 {
+		log.Fatalf("Error in Verify: %d of %d documents failed", failed, len(m.Entries))
+	}
+	log.Printf("Signature : %d documents valid", len(m.Entries))
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// verifyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	verifyCmd.Flags().String("batch", "", "check every document of a manifest written by sign --batch")
+	verifyCmd.Flags().String("merkle", "", "check a file against its inclusion proof, or a directory against its signed root")
+	verifyCmd.Flags().String("root", "", "directory signed with --merkle that a file is checked in")
+	verifyCmd.Flags().Int("workers", 0, "parallel checks in a batch (default one per CPU)")
+	verifyCmd.Flags().String("tsa-cert", "", "trusted timestamp authority certificates (PEM bundle or DER) the token must chain to")
+	verifyCmd.Flags().Bool("pdf", false, "check the signature embedded in the PDF")
+	verifyCmd.Flags().String("revocations", "revocations.json", "revocation list of enrollments whose signatures are rejected")
+	verifyCmd.Flags().String("public-key", "", "hex encoded public key the signature must be made with")
 }
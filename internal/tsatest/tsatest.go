@@ -0,0 +1,306 @@
+// Package tsatest runs a self-issuing RFC 3161 timestamp authority, a local
+// stand-in for a real TSA in the tests of packages that request timestamps.
+package tsatest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nart4hire/gofze/lib/tsa"
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA2        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519              = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	// oidPolicy is the policy of tokens issued by NewResponder, under the
+	// private enterprise number RFC 5612 reserves for documentation.
+	oidPolicy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 32473, 3161}
+)
+
+// maxQuery bounds the size of a request read by the responder.
+const maxQuery = 1 << 16
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type statusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type response struct {
+	Status         statusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+	Nonce          *big.Int  `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo    `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo keeps the signer identifier raw, as it is either an issuer and
+// serial number or a [0] subject key identifier.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+type responder struct {
+	key  crypto.Signer
+	cert *x509.Certificate
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// NewResponder returns a minimal RFC 3161 timestamp authority answering over
+// HTTP with tokens signed by key, whose certificate must be for timestamping.
+func NewResponder(key crypto.Signer, cert *x509.Certificate) http.Handler {
+	return &responder{key: key, cert: cert}
+}
+
+// reply writes a timestamp response.
+func reply(w http.ResponseWriter, resp response) {
+	der, err := asn1.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", tsa.ReplyType)
+	w.Write(der)
+}
+
+// refuse rejects a request, as a TSA does, within a successful response.
+func refuse(w http.ResponseWriter, reason string) {
+	reply(w, response{Status: statusInfo{Status: 2, StatusString: []string{reason}}})
+}
+
+func (r *responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != tsa.QueryType {
+		http.Error(w, "expected a POST of "+tsa.QueryType, http.StatusBadRequest)
+		return
+	}
+
+	der, err := io.ReadAll(io.LimitReader(req.Body, maxQuery))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := request{}
+	if rest, err := asn1.Unmarshal(der, &query); err != nil || len(rest) != 0 || query.Version != 1 {
+		refuse(w, "bad request")
+		return
+	}
+	if !query.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || len(query.MessageImprint.HashedMessage) != sha256.Size {
+		refuse(w, "bad algorithm")
+		return
+	}
+
+	token, err := r.issue(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reply(w, response{TimeStampToken: asn1.RawValue{FullBytes: token}})
+}
+
+// issue builds and signs the token answering a request.
+func (r *responder) issue(query request) ([]byte, error) {
+	r.mu.Lock()
+	r.serial++
+	serial := big.NewInt(r.serial)
+	r.mu.Unlock()
+
+	econtent, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         oidPolicy,
+		MessageImprint: query.MessageImprint,
+		SerialNumber:   serial,
+		GenTime:        time.Now().UTC().Truncate(time.Second),
+		Nonce:          query.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := r.signedAttributes(econtent)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, signature, err := r.sign(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: r.cert.RawIssuer},
+		SerialNumber: r.cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	octets, err := asn1.Marshal(econtent)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: octets},
+		},
+		Certificates: []asn1.RawValue{{FullBytes: r.cert.Raw}},
+		SignerInfos: []signerInfo{{
+			Version:         1,
+			SID:             asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			// Implicitly tagged [0], so the SET header is replaced
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: setContents(attrs)},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: algorithm},
+			Signature:          signature,
+		}},
+	}
+	content, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content},
+	})
+}
+
+// setContents strips the header of a DER SET.
+func setContents(set []byte) []byte {
+	raw := asn1.RawValue{}
+	asn1.Unmarshal(set, &raw)
+	return raw.Bytes
+}
+
+// signedAttributes encodes the content type, the digest of the TSTInfo and
+// the certificate of the TSA as the SET OF attributes that is signed.
+func (r *responder) signedAttributes(econtent []byte) ([]byte, error) {
+	digest := sha256.Sum256(econtent)
+	certHash := sha256.Sum256(r.cert.Raw)
+
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidTSTInfo},
+		{oidMessageDigest, digest[:]},
+		{oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	}
+
+	attrs := make([]attribute, len(values))
+	for i, v := range values {
+		b, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[i] = attribute{Type: v.oid, Values: []asn1.RawValue{{FullBytes: b}}}
+	}
+	return asn1.MarshalWithParams(attrs, "set")
+}
+
+// sign signs the attributes with the TSA key.
+func (r *responder) sign(attrs []byte) (asn1.ObjectIdentifier, []byte, error) {
+	digest := sha256.Sum256(attrs)
+	switch r.key.Public().(type) {
+	case *ecdsa.PublicKey:
+		signature, err := r.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		return oidECDSAWithSHA2, signature, err
+	case *rsa.PublicKey:
+		signature, err := r.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+		return oidRSAWithSHA256, signature, err
+	case ed25519.PublicKey:
+		signature, err := r.key.Sign(rand.Reader, attrs, crypto.Hash(0))
+		return oidEd25519, signature, err
+	}
+	return nil, nil, errors.New("gofze/internal/tsatest/tsatest.go: unsupported TSA key")
+}
@@ -0,0 +1,222 @@
+// Package auth logs subjects in with their biometric key. The server holds
+// the public key of an enrollment and issues a Challenge carrying a fresh
+// nonce; the client reproduces the key from a capture and answers with a
+// Schnorr signature over the challenge, which the server checks against the
+// enrolled key before the challenge expires.
+//
+// Challenges are signed with the Schnorr scheme the subject enrolled with,
+// lib.AlgSchnorr or lib.AlgBIP340. Every challenge is answered at most once,
+// as checking it removes it from the ChallengeStore of the server.
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// Algorithms are the Schnorr schemes that answer challenges.
+var Algorithms = []string{lib.AlgSchnorr, lib.AlgBIP340}
+
+// NonceLength is the size of the nonce of a challenge, in bytes.
+const NonceLength = 32
+
+// DefaultTTL is how long a challenge may be answered.
+const DefaultTTL = 2 * time.Minute
+
+// domain separates the signed challenges from every other use of the key.
+const domain = "gofze/auth/v1"
+
+// ErrUnknownChallenge is returned for responses to challenges that were never
+// issued, were already answered or have expired.
+var ErrUnknownChallenge = errors.New("gofze/lib/auth/auth.go: unknown or answered challenge")
+
+// Challenge asks the holder of an enrollment to prove it can reproduce its
+// key. It is signed whole, so a response only holds for this enrollment and
+// this server's nonce.
+type Challenge struct {
+	Nonce        []byte    `json:"nonce"`
+	Subject      string    `json:"subject,omitempty"`
+	EnrollmentID string    `json:"enrollmentId"`
+	IssuedAt     time.Time `json:"issuedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Response answers a challenge with a signature over its Message.
+type Response struct {
+	Nonce     []byte `json:"nonce"`
+	Algorithm string `json:"algorithm"`
+	Signature []byte `json:"signature"`
+}
+
+// Message is the encoding of the challenge that is signed, as the domain and
+// length prefixed fields in declaration order.
+func (c *Challenge) Message() []byte {
+	b := []byte(domain)
+	for _, field := range []string{
+		string(c.Nonce),
+		c.Subject,
+		c.EnrollmentID,
+		c.IssuedAt.UTC().Format(time.RFC3339Nano),
+		c.ExpiresAt.UTC().Format(time.RFC3339Nano),
+	} {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(field)))
+		b = append(b, field...)
+	}
+	return b
+}
+
+// Respond signs a challenge with the signer of a reproduced key, which must
+// be a Schnorr signer such as the one of e.Signer(key, "").
+func Respond(c *Challenge, signer lib.Signer) (*Response, error) {
+	if !slices.Contains(Algorithms, signer.Algorithm()) {
+		return nil, errors.New("gofze/lib/auth/auth.go: challenges are answered with " + strings.Join(Algorithms, " or "))
+	}
+	if len(c.Nonce) != NonceLength {
+		return nil, errors.New("gofze/lib/auth/auth.go: invalid nonce")
+	}
+
+	sig, err := signer.Sign(c.Message())
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Nonce: c.Nonce, Algorithm: signer.Algorithm(), Signature: sig}, nil
+}
+
+// Verifier issues challenges and checks their responses.
+type Verifier interface {
+	// Challenge issues a challenge to the holder of e, enrolled for subject.
+	Challenge(subject string, e *lib.Enrollment) (*Challenge, error)
+	// Check consumes the challenge r answers and checks that it was signed
+	// by the enrolled key of e, returning the challenge.
+	Check(r *Response, e *lib.Enrollment) (*Challenge, error)
+}
+
+type verifier struct {
+	challenges ChallengeStore
+	ttl        time.Duration
+}
+
+// NewVerifier returns a verifier keeping its pending challenges in
+// challenges, answerable for ttl, or DefaultTTL when it is not positive.
+func NewVerifier(challenges ChallengeStore, ttl time.Duration) Verifier {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &verifier{challenges: challenges, ttl: ttl}
+}
+
+// checkEnrollment rejects enrollments whose key cannot answer a challenge.
+func checkEnrollment(e *lib.Enrollment) error {
+	if e.ID == "" || len(e.PublicKey) == 0 {
+		return errors.New("gofze/lib/auth/auth.go: enrollment has no ID or public key")
+	}
+	if !slices.Contains(Algorithms, e.Algorithm) {
+		return errors.New("gofze/lib/auth/auth.go: enrollment signs with " + e.Algorithm + ", not " + strings.Join(Algorithms, " or "))
+	}
+	return nil
+}
+
+func (v *verifier) Challenge(subject string, e *lib.Enrollment) (*Challenge, error) {
+	if err := checkEnrollment(e); err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, NonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	c := &Challenge{
+		Nonce:        nonce,
+		Subject:      subject,
+		EnrollmentID: e.ID,
+		IssuedAt:     now,
+		ExpiresAt:    now.Add(v.ttl),
+	}
+	if err := v.challenges.Put(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (v *verifier) Check(r *Response, e *lib.Enrollment) (*Challenge, error) {
+	if err := checkEnrollment(e); err != nil {
+		return nil, err
+	}
+	if r.Algorithm != e.Algorithm {
+		return nil, errors.New("gofze/lib/auth/auth.go: response is not signed with " + e.Algorithm)
+	}
+
+	// Take the challenge before anything else, so a failed attempt also
+	// spends it and every nonce is tried at most once
+	c, err := v.challenges.Take(r.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(c.Nonce, r.Nonce) {
+		return nil, ErrUnknownChallenge
+	}
+	if !time.Now().Before(c.ExpiresAt) {
+		return nil, errors.New("gofze/lib/auth/auth.go: challenge expired")
+	}
+	if c.EnrollmentID != e.ID {
+		return nil, errors.New("gofze/lib/auth/auth.go: challenge was issued to another enrollment")
+	}
+	if err := lib.Verify(e.Algorithm, e.PublicKey, c.Message(), r.Signature); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SaveChallenge writes a challenge as JSON for the client to answer.
+func SaveChallenge(path string, c *Challenge) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadChallenge reads a challenge written by SaveChallenge.
+func LoadChallenge(path string) (*Challenge, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Challenge{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SaveResponse writes a response as JSON for the server to check.
+func SaveResponse(path string, r *Response) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadResponse reads a response written by SaveResponse.
+func LoadResponse(path string) (*Response, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Response{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,158 @@
+package auth_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/auth"
+)
+
+const (
+	template = "00112233445566778899aabbccddeeff"
+	// One bit away from template
+	capture = "00112233445566778899aabbccddeefe"
+)
+
+// enroll enrolls the template for login under alg, returning the record the
+// server holds and the helpers the client reproduces from.
+func enroll(t *testing.T, alg string) (*lib.Enrollment, *lib.Helpers[uint32]) {
+	e := &lib.Enrollment{ID: lib.NewEnrollmentID(), Source: "hex", Length: 16, HammingError: 4, Salt: lib.NewKeySalt(), Keys: lib.DefaultKeyLabels("")}
+	key, helpers, err := e.Extractor().Gen(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := e.Signer(key, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Algorithm, e.PublicKey = signer.Algorithm(), signer.PublicKey()
+	return e, helpers
+}
+
+// respond answers a challenge with the key reproduced from value.
+func respond(t *testing.T, c *Challenge, e *lib.Enrollment, helpers *lib.Helpers[uint32], value string) *Response {
+	key, err := e.Extractor().Rep(value, helpers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := e.Signer(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Respond(c, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestHandshake(t *testing.T) {
+	dir, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, challenges := range map[string]ChallengeStore{"memory": NewMemoryStore(), "dir": dir} {
+		for _, alg := range Algorithms {
+			t.Run(name+"/"+alg, func(t *testing.T) {
+				e, helpers := enroll(t, alg)
+				v := NewVerifier(challenges, 0)
+
+				c, err := v.Challenge("alice", e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := respond(t, c, e, helpers, capture)
+				checked, err := v.Check(r, e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if checked.Subject != "alice" || checked.EnrollmentID != e.ID {
+					t.Errorf("Unexpected challenge %v", checked)
+				}
+
+				// Responses are accepted once
+				if _, err := v.Check(r, e); !errors.Is(err, ErrUnknownChallenge) {
+					t.Errorf("Expected ErrUnknownChallenge on replay, got %v", err)
+				}
+
+				// A response to one challenge does not answer another
+				other, _ := v.Challenge("alice", e)
+				forged := *r
+				forged.Nonce = other.Nonce
+				if _, err := v.Check(&forged, e); err == nil {
+					t.Error("Accepted a signature over another challenge")
+				}
+				if _, err := v.Check(respond(t, other, e, helpers, capture), e); !errors.Is(err, ErrUnknownChallenge) {
+					t.Errorf("Expected the failed attempt to spend the challenge, got %v", err)
+				}
+
+				// Another enrollment cannot answer
+				impostor, impostorHelpers := enroll(t, alg)
+				c, _ = v.Challenge("alice", e)
+				if _, err := v.Check(respond(t, c, impostor, impostorHelpers, template), e); err == nil {
+					t.Error("Accepted the key of another enrollment")
+				}
+				c, _ = v.Challenge("alice", e)
+				if _, err := v.Check(respond(t, c, e, helpers, template), impostor); err == nil {
+					t.Error("Accepted a challenge issued to another enrollment")
+				}
+			})
+		}
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	e, helpers := enroll(t, lib.AlgBIP340)
+	v := NewVerifier(NewMemoryStore(), time.Millisecond)
+
+	c, err := v.Challenge("alice", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := v.Check(respond(t, c, e, helpers, capture), e); err == nil {
+		t.Error("Accepted an expired challenge")
+	}
+}
+
+func TestChallengeEnrollment(t *testing.T) {
+	e, _ := enroll(t, lib.AlgEd25519)
+	if _, err := NewVerifier(NewMemoryStore(), 0).Challenge("alice", e); err == nil {
+		t.Error("Challenged an enrollment that does not sign with Schnorr")
+	}
+}
+
+func TestDirStoreConcurrent(t *testing.T) {
+	root := t.TempDir()
+	e, helpers := enroll(t, lib.AlgBIP340)
+	s, _ := NewDirStore(root)
+	c, err := NewVerifier(s, 0).Challenge("alice", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := respond(t, c, e, helpers, capture)
+
+	// Separate verifiers contend through the directory only
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, _ := NewDirStore(root)
+			if _, err := NewVerifier(s, 0).Check(r, e); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("Accepted the response %d times", accepted)
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// challengeSuffix ends the name of every challenge of a directory store.
+const challengeSuffix = ".json"
+
+// ChallengeStore holds the challenges a server issued until they are answered.
+type ChallengeStore interface {
+	// Put records an issued challenge.
+	Put(c *Challenge) error
+	// Take removes and returns the challenge with the given nonce, or returns
+	// ErrUnknownChallenge. Of concurrent takes of one nonce only one succeeds.
+	Take(nonce []byte) (*Challenge, error)
+}
+
+type memorystore struct {
+	mu         sync.Mutex
+	challenges map[string]*Challenge
+}
+
+// NewMemoryStore returns a store of the challenges of a single server process.
+func NewMemoryStore() ChallengeStore {
+	return &memorystore{challenges: map[string]*Challenge{}}
+}
+
+func (s *memorystore) Put(c *Challenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Forget the challenges left unanswered
+	now := time.Now()
+	for nonce, pending := range s.challenges {
+		if !now.Before(pending.ExpiresAt) {
+			delete(s.challenges, nonce)
+		}
+	}
+	s.challenges[string(c.Nonce)] = c
+	return nil
+}
+
+func (s *memorystore) Take(nonce []byte) (*Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.challenges[string(nonce)]
+	if !ok {
+		return nil, ErrUnknownChallenge
+	}
+	delete(s.challenges, string(nonce))
+	return c, nil
+}
+
+type dirstore struct {
+	root string
+}
+
+// NewDirStore returns a store keeping every challenge in a <nonce>.json file
+// of root, so challenges issued by one process can be checked by another.
+// Take removes the file, which succeeds for a single process only.
+func NewDirStore(root string) (ChallengeStore, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &dirstore{root: root}, nil
+}
+
+func (s *dirstore) path(nonce []byte) string {
+	return filepath.Join(s.root, hex.EncodeToString(nonce)+challengeSuffix)
+}
+
+func (s *dirstore) Put(c *Challenge) error {
+	s.prune()
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path(c.Nonce), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the challenges left unanswered, ignoring failures as a later
+// Put tries again.
+func (s *dirstore) prune() {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), challengeSuffix) {
+			continue
+		}
+		path := filepath.Join(s.root, entry.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		c := &Challenge{}
+		if json.Unmarshal(b, c) == nil && !now.Before(c.ExpiresAt) {
+			os.Remove(path)
+		}
+	}
+}
+
+func (s *dirstore) Take(nonce []byte) (*Challenge, error) {
+	if len(nonce) != NonceLength {
+		return nil, ErrUnknownChallenge
+	}
+
+	path := s.path(nonce)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrUnknownChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Whoever removes the file answers the challenge
+	if err := os.Remove(path); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrUnknownChallenge
+	} else if err != nil {
+		return nil, err
+	}
+
+	c := &Challenge{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,368 @@
+// Package batch signs and verifies many documents with one signer, so the key
+// is reproduced from a capture once instead of once per file. Every document
+// gets its own signature bundle next to it, and a summary manifest lists them
+// all with the signer's key so the whole batch can be checked at once. The
+// manifest is signed too, over the digest of every document, so entries cannot
+// be dropped or swapped without the batch failing.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// ManifestName is the summary manifest written into a signed directory.
+const ManifestName = "gofze-batch.json"
+
+// SignatureSuffix is appended to a document's path to name its signature.
+const SignatureSuffix = ".sig"
+
+// Entry is one document of a batch with its digest. Error is set when it could
+// not be signed.
+type Entry struct {
+	File      string `json:"file"`
+	Digest    []byte `json:"digest,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Manifest summarises a signed batch. Directory is set when the batch is
+// every document of the directory holding the manifest, so documents added
+// later can be told apart. Signature is set by SaveManifest and covers every
+// other field, with the paths as written.
+type Manifest struct {
+	Algorithm string  `json:"algorithm"`
+	Digest    string  `json:"digest"`
+	PublicKey []byte  `json:"publicKey"`
+	Directory bool    `json:"directory,omitempty"`
+	Entries   []Entry `json:"entries"`
+	Signature []byte  `json:"signature,omitempty"`
+}
+
+// Result is the outcome of verifying one document.
+type Result struct {
+	File string
+	Err  error
+}
+
+// Files lists the documents of a batch. A directory is walked for regular
+// files, leaving out signatures and manifests; any other file is read as a
+// list of paths, one per line and relative to the list, where blank lines and
+// lines starting with # are skipped.
+func Files(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := d.Name()
+			if d.Type().IsRegular() && !strings.HasSuffix(name, SignatureSuffix) && name != ManifestName {
+				files = append(files, file)
+			}
+			return nil
+		})
+	} else {
+		var b []byte
+		if b, err = os.ReadFile(path); err == nil {
+			scanner := bufio.NewScanner(bytes.NewReader(b))
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				if !filepath.IsAbs(line) {
+					line = filepath.Join(filepath.Dir(path), line)
+				}
+				files = append(files, line)
+			}
+			err = scanner.Err()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, errors.New("gofze/lib/batch/batch.go: no documents in " + path)
+	}
+	return files, nil
+}
+
+// poolSize defaults to one worker per CPU.
+func poolSize(n int) int {
+	if n <= 0 {
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+// run calls do for every index on a bounded pool of workers.
+func run(n, workers int, do func(i int)) {
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				do(i)
+			}
+		}()
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// signFile streams a document through the digest and writes its signature,
+// returning the signature's path and the digest.
+func signFile(signer lib.Signer, digest, file string) (string, []byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	sum, err := lib.HashReader(digest, f)
+	if err != nil {
+		return "", nil, err
+	}
+	sb, err := lib.SignDigest(signer, digest, sum)
+	if err != nil {
+		return "", nil, err
+	}
+
+	path := file + SignatureSuffix
+	return path, sum, lib.SaveSignature(path, sb)
+}
+
+// Sign signs every file on up to workers goroutines and writes each signature
+// next to its document. Documents that fail are recorded in the manifest
+// rather than stopping the batch.
+func Sign(signer lib.Signer, digest string, files []string, workers int) (*Manifest, error) {
+	// Reject an unknown digest before touching any file
+	if _, err := lib.HashReader(digest, bytes.NewReader(nil)); err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Algorithm: signer.Algorithm(),
+		Digest:    digest,
+		PublicKey: signer.PublicKey(),
+		Entries:   make([]Entry, len(files)),
+	}
+
+	run(len(files), poolSize(workers), func(i int) {
+		m.Entries[i].File = files[i]
+		signature, sum, err := signFile(signer, digest, files[i])
+		if err != nil {
+			m.Entries[i].Error = err.Error()
+			return
+		}
+		m.Entries[i].Signature, m.Entries[i].Digest = signature, sum
+	})
+	return m, nil
+}
+
+// Failed counts the entries that could not be signed.
+func (m *Manifest) Failed() int {
+	failed := 0
+	for _, entry := range m.Entries {
+		if entry.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// verifyEntry checks one document against its signature and the batch key.
+func verifyEntry(m *Manifest, entry Entry) error {
+	if entry.Error != "" {
+		return errors.New("gofze/lib/batch/batch.go: not signed: " + entry.Error)
+	}
+
+	sb, err := lib.LoadSignature(entry.Signature)
+	if err != nil {
+		return err
+	}
+	if sb.Algorithm != m.Algorithm || !bytes.Equal(sb.PublicKey, m.PublicKey) {
+		return errors.New("gofze/lib/batch/batch.go: signed by another key")
+	}
+	if sb.Digest != m.Digest {
+		return errors.New("gofze/lib/batch/batch.go: signed with another digest")
+	}
+
+	f, err := os.Open(entry.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum, err := lib.HashReader(m.Digest, f)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum, entry.Digest) {
+		return errors.New("gofze/lib/batch/batch.go: document differs from the manifest")
+	}
+	return sb.VerifyDigest(sum)
+}
+
+// Verify checks every entry of the manifest on up to workers goroutines and
+// returns the outcome per document, in manifest order.
+func Verify(m *Manifest, workers int) []Result {
+	results := make([]Result, len(m.Entries))
+	run(len(m.Entries), poolSize(workers), func(i int) {
+		results[i] = Result{File: m.Entries[i].File, Err: verifyEntry(m, m.Entries[i])}
+	})
+	return results
+}
+
+// relocate rewrites the paths of every entry.
+func (m *Manifest) relocate(path func(string) (string, error)) (*Manifest, error) {
+	out := *m
+	out.Entries = make([]Entry, len(m.Entries))
+	for i, entry := range m.Entries {
+		var err error
+		out.Entries[i] = entry
+		if out.Entries[i].File, err = path(entry.File); err != nil {
+			return nil, err
+		}
+		if entry.Signature != "" {
+			if out.Entries[i].Signature, err = path(entry.Signature); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &out, nil
+}
+
+// message is the encoding of the manifest that is signed, as length prefixed
+// fields in declaration order followed by every entry.
+func (m *Manifest) message() []byte {
+	b := []byte("gofze/batch/v1")
+	field := func(f []byte) {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	field([]byte(m.Algorithm))
+	field([]byte(m.Digest))
+	field(m.PublicKey)
+	if m.Directory {
+		field([]byte("directory"))
+	} else {
+		field(nil)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(m.Entries)))
+	for _, entry := range m.Entries {
+		field([]byte(entry.File))
+		field(entry.Digest)
+		field([]byte(entry.Signature))
+		field([]byte(entry.Error))
+	}
+	return b
+}
+
+// SaveManifest signs the manifest with the signer of the batch and writes it
+// as JSON, with paths relative to it so the signed folder can be moved as a
+// whole.
+func SaveManifest(path string, m *Manifest, signer lib.Signer) error {
+	if signer.Algorithm() != m.Algorithm || !bytes.Equal(signer.PublicKey(), m.PublicKey) {
+		return errors.New("gofze/lib/batch/batch.go: manifest must be signed by the signer of the batch")
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	relative, err := m.relocate(func(file string) (string, error) {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(dir, abs)
+		return filepath.ToSlash(rel), err
+	})
+	if err != nil {
+		return err
+	}
+	if relative.Signature, err = signer.Sign(relative.message()); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(relative, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadManifest reads a manifest written by SaveManifest and checks its
+// signature against the batch key it names. Callers must still check that
+// key is the one they trust.
+func LoadManifest(path string) (*Manifest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	if m.Algorithm == "" || len(m.PublicKey) == 0 || len(m.Entries) == 0 {
+		return nil, errors.New("gofze/lib/batch/batch.go: incomplete manifest")
+	}
+	if err := lib.Verify(m.Algorithm, m.PublicKey, m.message(), m.Signature); err != nil {
+		return nil, errors.New("gofze/lib/batch/batch.go: manifest signature: " + err.Error())
+	}
+
+	return m.relocate(func(file string) (string, error) {
+		return filepath.Join(filepath.Dir(path), filepath.FromSlash(file)), nil
+	})
+}
+
+// Unlisted returns the documents of the directory of a manifest loaded from
+// path that it does not list, for manifests of a whole directory.
+func Unlisted(path string, m *Manifest) ([]string, error) {
+	if !m.Directory {
+		return nil, nil
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range m.Entries {
+		listed[filepath.Clean(entry.File)] = true
+	}
+	files, err := Files(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	unlisted := []string{}
+	for _, file := range files {
+		if !listed[filepath.Clean(file)] {
+			unlisted = append(unlisted, file)
+		}
+	}
+	return unlisted, nil
+}
@@ -0,0 +1,163 @@
+package batch_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/batch"
+)
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "nested"), 0o755)
+	for _, name := range []string{"a.txt", "b.pdf", "nested/c.bin"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("document "+name), 0o600)
+	}
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 documents, got %v", files)
+	}
+
+	s, err := lib.NewSigner(lib.AlgEd25519, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := Sign(s, lib.DigestSHA256, files, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Failed() != 0 {
+		t.Fatalf("Unexpected failures: %+v", m.Entries)
+	}
+
+	m.Directory = true
+	path := filepath.Join(dir, ManifestName)
+	if err := SaveManifest(path, m, s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signatures and the manifest are not documents of a later batch
+	if again, _ := Files(dir); len(again) != 3 {
+		t.Errorf("Signatures were listed as documents: %v", again)
+	}
+
+	// The signed folder verifies after being moved
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadManifest(filepath.Join(moved, ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range Verify(loaded, 2) {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.File, r.Err)
+		}
+	}
+
+	if unlisted, err := Unlisted(filepath.Join(moved, ManifestName), loaded); err != nil || len(unlisted) != 0 {
+		t.Errorf("Unexpected unlisted documents %v (%v)", unlisted, err)
+	}
+
+	// Documents added later are not part of the batch
+	os.WriteFile(filepath.Join(moved, "d.txt"), []byte("added"), 0o600)
+	if unlisted, _ := Unlisted(filepath.Join(moved, ManifestName), loaded); len(unlisted) != 1 || filepath.Base(unlisted[0]) != "d.txt" {
+		t.Errorf("Expected d.txt to be unlisted, got %v", unlisted)
+	}
+
+	os.WriteFile(filepath.Join(moved, "b.pdf"), []byte("tampered"), 0o600)
+	for _, r := range Verify(loaded, 2) {
+		if tampered := filepath.Base(r.File) == "b.pdf"; tampered != (r.Err != nil) {
+			t.Errorf("%s: unexpected result %v", r.File, r.Err)
+		}
+	}
+}
+
+func TestFilesList(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o600)
+	list := filepath.Join(dir, "documents.txt")
+	os.WriteFile(list, []byte("# release\na.txt\n\nmissing.txt\n"), 0o600)
+
+	files, err := Files(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != filepath.Join(dir, "a.txt") {
+		t.Fatalf("Unexpected documents: %v", files)
+	}
+
+	s, _ := lib.NewSigner(lib.AlgECDSAP256, bytes.Repeat([]byte{7}, 32))
+	m, err := Sign(s, lib.DigestSHA512, files, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Failed() != 1 || m.Entries[1].Error == "" {
+		t.Errorf("Expected the missing document to fail: %+v", m.Entries)
+	}
+
+	results := Verify(m, 0)
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	if _, err := Sign(s, "md5", files, 0); err == nil {
+		t.Error("Unknown digest was accepted")
+	}
+}
+
+func TestManifestTampered(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("document "+name), 0o600)
+	}
+	files, _ := Files(dir)
+	s, _ := lib.NewSigner(lib.AlgEd25519, bytes.Repeat([]byte{7}, 32))
+	m, err := Sign(s, lib.DigestSHA256, files, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ManifestName)
+	if err := SaveManifest(path, m, s); err != nil {
+		t.Fatal(err)
+	}
+
+	other, _ := lib.NewSigner(lib.AlgEd25519, bytes.Repeat([]byte{8}, 32))
+	if err := SaveManifest(filepath.Join(t.TempDir(), ManifestName), m, other); err == nil {
+		t.Error("Signed the manifest with another key")
+	}
+
+	b, _ := os.ReadFile(path)
+	cases := map[string]func(m map[string]any){
+		"dropped entry": func(m map[string]any) {
+			m["entries"] = m["entries"].([]any)[1:]
+		},
+		"swapped digest": func(m map[string]any) {
+			entries := m["entries"].([]any)
+			first, second := entries[0].(map[string]any), entries[1].(map[string]any)
+			first["digest"], second["digest"] = second["digest"], first["digest"]
+		},
+		"unsigned": func(m map[string]any) {
+			delete(m, "signature")
+		},
+	}
+	for name, tamper := range cases {
+		manifest := map[string]any{}
+		json.Unmarshal(b, &manifest)
+		tamper(manifest)
+		tampered, _ := json.Marshal(manifest)
+		os.WriteFile(path, tampered, 0o644)
+		if _, err := LoadManifest(path); err == nil {
+			t.Errorf("%s: loaded a tampered manifest", name)
+		}
+	}
+}
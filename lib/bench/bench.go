@@ -0,0 +1,241 @@
+// Package bench measures the cost of Gen and Rep for every extractor width over
+// a grid of vector sizes, hamming errors and locker KDF settings, so deployments
+// can be sized on the target machine. The same grid backs the Benchmark
+// functions of this package and the "gofze bench" command.
+package bench
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// KDF names a locker KDF setting such as "sha256:1000".
+type KDF struct {
+	Name string
+	lib.KDFParams
+}
+
+// Case is one point of the grid. Bits is the size of the biometric vector, so
+// extractors of different widths are compared on the same input.
+type Case struct {
+	Width        int
+	Bits         int
+	HammingError int
+	KDF          KDF
+}
+
+// MinTime is how long Run repeats each operation at least.
+var MinTime = time.Second
+
+// Measurement is the cost of N runs of an operation.
+type Measurement struct {
+	N         int
+	T         time.Duration
+	MemAllocs uint64
+	MemBytes  uint64
+}
+
+// NsPerOp returns the time of one run in nanoseconds.
+func (m Measurement) NsPerOp() int64 {
+	if m.N <= 0 {
+		return 0
+	}
+	return m.T.Nanoseconds() / int64(m.N)
+}
+
+// AllocsPerOp returns the heap allocations of one run.
+func (m Measurement) AllocsPerOp() int64 {
+	if m.N <= 0 {
+		return 0
+	}
+	return int64(m.MemAllocs) / int64(m.N)
+}
+
+// Result is the measured cost of one case. Rep is measured on an impostor
+// reading, the worst case where every locker is tried.
+type Result struct {
+	Case
+	Lockers     int
+	HelperBytes int
+	Gen         Measurement
+	Rep         Measurement
+}
+
+// ParseKDF parses a "hash:iterations" setting, where hash is sha256 or sha512.
+func ParseKDF(setting string) (KDF, error) {
+	name, iterations, ok := strings.Cut(setting, ":")
+	if !ok {
+		iterations = "1"
+	}
+
+	n, err := strconv.Atoi(iterations)
+	if err != nil || n < 1 {
+		return KDF{}, errors.New("gofze/lib/bench/bench.go: invalid KDF iterations")
+	}
+
+	var h func() hash.Hash
+	switch name {
+	case "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return KDF{}, errors.New("gofze/lib/bench/bench.go: unknown KDF hash " + name)
+	}
+	return KDF{Name: name + ":" + strconv.Itoa(n), KDFParams: lib.KDFParams{Hash: h, Iterations: n}}, nil
+}
+
+// Grid returns every combination of the given settings.
+func Grid(widths, bits, hammingErrors []int, kdfs []KDF) []Case {
+	cases := []Case{}
+	for _, width := range widths {
+		for _, b := range bits {
+			for _, hammingError := range hammingErrors {
+				for _, kdf := range kdfs {
+					cases = append(cases, Case{width, b, hammingError, kdf})
+				}
+			}
+		}
+	}
+	return cases
+}
+
+// String names the case for benchmark output.
+func (c Case) String() string {
+	return fmt.Sprintf("width=%d/bits=%d/hamming=%d/kdf=%s", c.Width, c.Bits, c.HammingError, c.KDF.Name)
+}
+
+// Bench holds one run of Gen and of Rep for a case, to be timed by Run or by
+// the Benchmark functions of this package.
+type Bench struct {
+	Case
+	Lockers     int
+	HelperBytes int
+	Gen         func()
+	Rep         func()
+}
+
+// New prepares the extractor of a case and enrolls a random reading for Rep.
+func New(c Case) (*Bench, error) {
+	if c.Width != 8 && c.Width != 16 && c.Width != 32 && c.Width != 64 {
+		return nil, errors.New("gofze/lib/bench/bench.go: width must be 8, 16, 32 or 64")
+	}
+
+	if c.Bits <= 0 || c.Bits%c.Width != 0 {
+		return nil, errors.New("gofze/lib/bench/bench.go: bits must be a multiple of the width")
+	}
+
+	switch c.Width {
+	case 8:
+		return newBench(c, extractor[uint8](c))
+	case 16:
+		return newBench(c, extractor[uint16](c))
+	case 32:
+		return newBench(c, extractor[uint32](c))
+	}
+	return newBench(c, extractor[uint64](c))
+}
+
+func extractor[T lib.Number](c Case) lib.FuzzyExtractor[T] {
+	return lib.NewGenericFuzzyExtractor[T](c.Bits/c.Width, c.HammingError, 0.001, 2, 16, c.KDF.KDFParams)
+}
+
+func newBench[T lib.Number](c Case, fe lib.FuzzyExtractor[T]) (*Bench, error) {
+	value, impostor := randomHex(c.Bits/8), randomHex(c.Bits/8)
+	_, helpers, err := fe.Gen(value)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Bench{
+		Case:        c,
+		Lockers:     helpers.Lockers(),
+		HelperBytes: len(b),
+		Gen:         func() { fe.Gen(value) },
+		Rep:         func() { fe.Rep(impostor, helpers) },
+	}, nil
+}
+
+// measure runs op until MinTime has passed, growing the number of runs the way
+// testing.Benchmark does, and counts the allocations of the last round.
+func measure(op func()) Measurement {
+	var before, after runtime.MemStats
+	for n := 1; ; {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		for range n {
+			op()
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= MinTime || n >= 1e9 {
+			return Measurement{
+				N:         n,
+				T:         elapsed,
+				MemAllocs: after.Mallocs - before.Mallocs,
+				MemBytes:  after.TotalAlloc - before.TotalAlloc,
+			}
+		}
+
+		// Aim 20% past MinTime at the rate seen so far, growing at most 100 fold
+		next := 100 * n
+		if elapsed > 0 {
+			next = min(next, int(int64(n)*int64(MinTime)*6/5/int64(elapsed)))
+		}
+		n = max(next, n+1)
+	}
+}
+
+// Run measures one case.
+func Run(c Case) (Result, error) {
+	bn, err := New(c)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Case:        c,
+		Lockers:     bn.Lockers,
+		HelperBytes: bn.HelperBytes,
+		Gen:         measure(bn.Gen),
+		Rep:         measure(bn.Rep),
+	}, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WriteTable prints one row per result.
+func WriteTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "width\tbits\thamming\tkdf\tlockers\thelper bytes\tgen ns/op\tgen allocs/op\trep ns/op\trep allocs/op\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			r.Width, r.Bits, r.HammingError, r.KDF.Name, r.Lockers, r.HelperBytes,
+			r.Gen.NsPerOp(), r.Gen.AllocsPerOp(), r.Rep.NsPerOp(), r.Rep.AllocsPerOp())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,81 @@
+package bench_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/nart4hire/gofze/lib/bench"
+)
+
+func grid(b testing.TB) []Case {
+	kdfs := []KDF{}
+	for _, setting := range []string{"sha256:1", "sha256:100", "sha512:1"} {
+		kdf, err := ParseKDF(setting)
+		if err != nil {
+			b.Fatal(err)
+		}
+		kdfs = append(kdfs, kdf)
+	}
+	return Grid([]int{8, 32}, []int{128, 256, 512}, []int{2, 4, 6}, kdfs)
+}
+
+// benchmark times op, reporting the helper size as a custom metric.
+func benchmark(bn *Bench, op func()) func(b *testing.B) {
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		b.ReportMetric(float64(bn.HelperBytes), "helper-bytes")
+		for range b.N {
+			op()
+		}
+	}
+}
+
+func BenchmarkGen(b *testing.B) {
+	for _, c := range grid(b) {
+		bn, err := New(c)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.String(), benchmark(bn, bn.Gen))
+	}
+}
+
+func BenchmarkRep(b *testing.B) {
+	for _, c := range grid(b) {
+		bn, err := New(c)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.String(), benchmark(bn, bn.Rep))
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	kdf, err := ParseKDF("sha256:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	minTime := MinTime
+	t.Cleanup(func() { MinTime = minTime })
+	MinTime = 50 * time.Millisecond
+	r, err := Run(Case{Width: 32, Bits: 128, HammingError: 1, KDF: kdf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Lockers == 0 || r.HelperBytes == 0 || r.Gen.N == 0 || r.Rep.N == 0 || r.Gen.AllocsPerOp() == 0 {
+		t.Errorf("Incomplete result: %+v", r)
+	}
+
+	var table strings.Builder
+	WriteTable(&table, []Result{r})
+	if !strings.Contains(table.String(), "helper bytes") || !strings.Contains(table.String(), "sha256:1") {
+		t.Errorf("Unexpected table:\n%s", table.String())
+	}
+
+	if _, err := ParseKDF("md5:1"); err == nil {
+		t.Error("Expected unknown KDF hash to be rejected")
+	}
+}
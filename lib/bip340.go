@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// bip340signer signs the SHA-256 digest of a message with BIP-340 Schnorr over
+// secp256k1, giving 32 byte x-only public keys and 64 byte signatures.
+type bip340signer struct {
+	priv *btcec.PrivateKey
+}
+
+func newBIP340Signer(key []byte) (Signer, error) {
+	if len(key) < 32 {
+		return nil, errors.New("gofze/lib/bip340.go: bip340 needs a 32 byte key")
+	}
+
+	// Map the key onto [1, n-1]
+	n := btcec.S256().N
+	d := new(big.Int).SetBytes(key)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	priv, _ := btcec.PrivKeyFromBytes(d.FillBytes(make([]byte, 32)))
+	return &bip340signer{priv}, nil
+}
+
+func (s *bip340signer) Algorithm() string { return AlgBIP340 }
+
+func (s *bip340signer) PublicKey() []byte {
+	return schnorr.SerializePubKey(s.priv.PubKey())
+}
+
+func (s *bip340signer) Sign(message []byte) ([]byte, error) {
+	var aux [32]byte
+	rand.Read(aux[:])
+	digest := sha256.Sum256(message)
+	return signBIP340(s.priv, digest[:], aux)
+}
+
+// SignBIP340 signs a 32 byte message with the secret key and auxiliary
+// randomness exactly as specified by BIP-340.
+func SignBIP340(key, message []byte, aux [32]byte) ([]byte, error) {
+	if len(key) != 32 {
+		return nil, errors.New("gofze/lib/bip340.go: invalid secret key")
+	}
+
+	priv, _ := btcec.PrivKeyFromBytes(key)
+	if priv.Key.IsZero() || new(big.Int).SetBytes(key).Cmp(btcec.S256().N) >= 0 {
+		return nil, errors.New("gofze/lib/bip340.go: invalid secret key")
+	}
+	return signBIP340(priv, message, aux)
+}
+
+func signBIP340(priv *btcec.PrivateKey, message []byte, aux [32]byte) ([]byte, error) {
+	sig, err := schnorr.Sign(priv, message, schnorr.CustomNonce(aux))
+	if err != nil {
+		return nil, err
+	}
+	return sig.Serialize(), nil
+}
+
+// VerifyBIP340 checks a BIP-340 signature over a 32 byte message.
+func VerifyBIP340(publicKey, message, signature []byte) error {
+	pub, err := schnorr.ParsePubKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	sig, err := schnorr.ParseSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	if !sig.Verify(message, pub) {
+		return errors.New("gofze/lib/bip340.go: invalid signature")
+	}
+	return nil
+}
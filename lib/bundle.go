@@ -0,0 +1,239 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Digest algorithms of signature bundles.
+const (
+	DigestSHA256 = "sha256"
+	DigestSHA512 = "sha512"
+)
+
+// SignatureBundle is a detached signature together with what is needed to
+// check it. When Digest is set the signature covers the digest of the
+// document, tagged with the algorithm name, instead of the document itself, so
+// documents of any size are hashed as a stream. Attributes, when present, are
+// covered by the signature too. Timestamp holds an RFC 3161 timestamp token
+// over the signature, which is not itself signed.
+type SignatureBundle struct {
+	Algorithm  string      `json:"algorithm"`
+	Digest     string      `json:"digest,omitempty"`
+	Attributes *Attributes `json:"attributes,omitempty"`
+	PublicKey  []byte      `json:"publicKey"`
+	Signature  []byte      `json:"signature"`
+	Timestamp  []byte      `json:"timestamp,omitempty"`
+}
+
+// Attributes describe a signature for later audits.
+type Attributes struct {
+	SigningTime time.Time `json:"signingTime"`
+	SignerID    string    `json:"signerId,omitempty"`
+	ContentType string    `json:"contentType,omitempty"`
+	Filename    string    `json:"filename,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	ParamsHash  []byte    `json:"paramsHash,omitempty"`
+}
+
+// encode is the unambiguous encoding of the attributes that is signed, as
+// length prefixed fields in declaration order.
+func (a *Attributes) encode() []byte {
+	b := []byte("gofze/attributes/v1")
+	b = appendField(b, []byte(a.SigningTime.UTC().Format(time.RFC3339Nano)))
+	b = appendField(b, []byte(a.SignerID))
+	b = appendField(b, []byte(a.ContentType))
+	b = appendField(b, []byte(a.Filename))
+	b = appendField(b, []byte(a.Version))
+	return appendField(b, a.ParamsHash)
+}
+
+// KeyID names a signer by the first 8 bytes of the SHA-256 of its public key,
+// in hex.
+func KeyID(pub []byte) string {
+	id := sha256.Sum256(pub)
+	return hex.EncodeToString(id[:8])
+}
+
+// Version is the gofze module version from the build information, "(devel)"
+// for local builds.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+
+	if info.Main.Path == "github.com/nart4hire/gofze" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/nart4hire/gofze" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+func newDigest(name string) (hash.Hash, error) {
+	switch name {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	}
+	return nil, errors.New("gofze/lib/bundle.go: unknown digest " + name)
+}
+
+// HashReader streams r through the named digest.
+func HashReader(name string, r io.Reader) ([]byte, error) {
+	h, err := newDigest(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// digestMessage is what is signed for a digest, so a signed digest can never
+// be mistaken for a signed document that happens to hold the same bytes.
+func digestMessage(name string, sum []byte) []byte {
+	return append([]byte("gofze/digest/"+name+":"), sum...)
+}
+
+// SignBundle signs message and bundles the signature with the signer's key.
+func SignBundle(s Signer, message []byte) (*SignatureBundle, error) {
+	sig, err := s.Sign(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignatureBundle{
+		Algorithm: s.Algorithm(),
+		PublicKey: s.PublicKey(),
+		Signature: sig,
+	}, nil
+}
+
+// SignDigest signs a digest computed with HashReader.
+func SignDigest(s Signer, name string, sum []byte) (*SignatureBundle, error) {
+	return SignDigestWithAttributes(s, name, sum, nil)
+}
+
+// SignDigestWithAttributes signs a digest together with attributes, which may
+// be nil.
+func SignDigestWithAttributes(s Signer, name string, sum []byte, attrs *Attributes) (*SignatureBundle, error) {
+	if _, err := newDigest(name); err != nil {
+		return nil, err
+	}
+
+	sb, err := SignBundle(s, signedMessage(name, sum, attrs))
+	if err != nil {
+		return nil, err
+	}
+	sb.Digest = name
+	sb.Attributes = attrs
+	return sb, nil
+}
+
+// signedMessage is the digest message followed by the attributes. Digests have
+// a fixed length, so the attributes cannot be confused with a longer digest.
+func signedMessage(name string, sum []byte, attrs *Attributes) []byte {
+	message := digestMessage(name, sum)
+	if attrs != nil {
+		message = append(message, attrs.encode()...)
+	}
+	return message
+}
+
+// SignReader hashes a document as a stream and signs its digest.
+func SignReader(s Signer, name string, r io.Reader) (*SignatureBundle, error) {
+	return SignReaderWithAttributes(s, name, r, nil)
+}
+
+// SignReaderWithAttributes hashes a document as a stream and signs its digest
+// together with attributes, which may be nil.
+func SignReaderWithAttributes(s Signer, name string, r io.Reader, attrs *Attributes) (*SignatureBundle, error) {
+	sum, err := HashReader(name, r)
+	if err != nil {
+		return nil, err
+	}
+	return SignDigestWithAttributes(s, name, sum, attrs)
+}
+
+// Verify checks the bundled signature over message.
+func (sb *SignatureBundle) Verify(message []byte) error {
+	if sb.Digest == "" && sb.Attributes == nil {
+		return Verify(sb.Algorithm, sb.PublicKey, message, sb.Signature)
+	}
+	return sb.VerifyReader(bytes.NewReader(message))
+}
+
+// VerifyReader checks the bundled signature over a document read from r,
+// which is only held in memory for bundles without a digest.
+func (sb *SignatureBundle) VerifyReader(r io.Reader) error {
+	if sb.Digest == "" {
+		if sb.Attributes != nil {
+			return errors.New("gofze/lib/bundle.go: attributes need a digest")
+		}
+		message, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return sb.Verify(message)
+	}
+
+	sum, err := HashReader(sb.Digest, r)
+	if err != nil {
+		return err
+	}
+	return sb.VerifyDigest(sum)
+}
+
+// VerifyDigest checks the bundled signature over a digest computed with
+// HashReader and the bundle's Digest.
+func (sb *SignatureBundle) VerifyDigest(sum []byte) error {
+	if sb.Digest == "" {
+		return errors.New("gofze/lib/bundle.go: bundle signs no digest")
+	}
+	return Verify(sb.Algorithm, sb.PublicKey, signedMessage(sb.Digest, sum, sb.Attributes), sb.Signature)
+}
+
+// SaveSignature writes the bundle as JSON.
+func SaveSignature(path string, sb *SignatureBundle) error {
+	b, err := json.MarshalIndent(sb, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadSignature reads a bundle written by SaveSignature.
+func LoadSignature(path string) (*SignatureBundle, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &SignatureBundle{}
+	if err := json.Unmarshal(b, sb); err != nil {
+		return nil, err
+	}
+
+	if sb.Algorithm == "" || len(sb.Signature) == 0 {
+		return nil, errors.New("gofze/lib/bundle.go: incomplete signature bundle")
+	}
+	return sb, nil
+}
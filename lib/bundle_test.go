@@ -0,0 +1,144 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestSignReader(t *testing.T) {
+	key, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	s, err := NewSigner(AlgEd25519, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := bytes.Repeat([]byte("gofze streamed document\n"), 1<<16)
+	for _, digest := range []string{DigestSHA256, DigestSHA512} {
+		sb, err := SignReader(s, digest, bytes.NewReader(document))
+		if err != nil {
+			t.Fatalf("%s: %v", digest, err)
+		}
+		if sb.Digest != digest {
+			t.Errorf("%s: bundle records %s", digest, sb.Digest)
+		}
+
+		if err := sb.VerifyReader(bytes.NewReader(document)); err != nil {
+			t.Errorf("%s: %v", digest, err)
+		}
+		if err := sb.Verify(document); err != nil {
+			t.Errorf("%s: %v", digest, err)
+		}
+
+		tampered := bytes.Clone(document)
+		tampered[len(tampered)/2] ^= 0x01
+		if err := sb.VerifyReader(bytes.NewReader(tampered)); err == nil {
+			t.Errorf("%s: tampered document verified", digest)
+		}
+	}
+
+	if _, err := SignReader(s, "md5", strings.NewReader("")); err == nil {
+		t.Error("Unknown digest was accepted")
+	}
+}
+
+func TestLegacyBundle(t *testing.T) {
+	key, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	s, err := NewSigner(AlgECDSAP256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bundles without a digest sign the message itself
+	message := []byte("gofze signed message")
+	sb, err := SignBundle(s, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sb.Digest != "" {
+		t.Errorf("Legacy bundle records digest %s", sb.Digest)
+	}
+	if err := sb.VerifyReader(bytes.NewReader(message)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignedAttributes(t *testing.T) {
+	key, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	s, err := NewSigner(AlgBIP340, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := []byte("%PDF-1.4 document")
+	attrs := &Attributes{
+		SigningTime: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.FixedZone("WIB", 7*3600)),
+		SignerID:    "nathanael",
+		ContentType: "application/pdf",
+		Filename:    "test.pdf",
+		Version:     Version(),
+		ParamsHash:  (&Enrollment{Source: "fingerprint", Length: 32, HammingError: 4}).ParamsHash(),
+	}
+	sb, err := SignReaderWithAttributes(s, DigestSHA256, bytes.NewReader(document), attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The attributes survive a round trip through JSON
+	path := filepath.Join(t.TempDir(), "signature.json")
+	if err := SaveSignature(path, sb); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSignature(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Verify(document); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every attribute is covered by the signature
+	edits := []func(a *Attributes){
+		func(a *Attributes) { a.SigningTime = a.SigningTime.Add(time.Nanosecond) },
+		func(a *Attributes) { a.SignerID = "mallory" },
+		func(a *Attributes) { a.ContentType = "text/plain" },
+		func(a *Attributes) { a.Filename = "other.pdf" },
+		func(a *Attributes) { a.Version = "v9.9.9" },
+		func(a *Attributes) { a.ParamsHash[0] ^= 1 },
+	}
+	for i, edit := range edits {
+		forged := *loaded
+		a := *loaded.Attributes
+		a.ParamsHash = bytes.Clone(a.ParamsHash)
+		edit(&a)
+		forged.Attributes = &a
+		if err := forged.Verify(document); err == nil {
+			t.Errorf("Edit %d of the attributes verified", i)
+		}
+	}
+
+	stripped := *loaded
+	stripped.Attributes = nil
+	if err := stripped.Verify(document); err == nil {
+		t.Error("Stripped attributes verified")
+	}
+}
+
+func TestParamsHash(t *testing.T) {
+	e := &Enrollment{Source: "fingerprint", Length: 32, HammingError: 4, Helpers: []byte{1}}
+	other := *e
+	other.Helpers = []byte{2}
+	if !bytes.Equal(e.ParamsHash(), other.ParamsHash()) {
+		t.Error("Helpers changed the parameters hash")
+	}
+
+	other.HammingError = 6
+	if bytes.Equal(e.ParamsHash(), other.ParamsHash()) {
+		t.Error("Parameters did not change the hash")
+	}
+}
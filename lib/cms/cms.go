@@ -0,0 +1,373 @@
+// Package cms writes and checks detached CMS (PKCS #7) SignedData signatures,
+// as defined by RFC 5652, for document systems that only accept that format.
+// The signer key is carried in a self-signed certificate generated from the
+// derived signing key, so only the Ed25519 (RFC 8419) and ECDSA P-256 signers
+// can be used; CMS has no identifier for the goschnorr group.
+package cms
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidECDSAWithSHA2 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// PEMType is the PEM block type of encoded signatures, as written by OpenSSL.
+const PEMType = "CMS"
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	SignerInfos      []signerInfo    `asn1:"set"`
+}
+
+// encapContentInfo has no eContent, as the signature is detached.
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo keeps the signed attributes raw, as the signature covers their
+// exact DER encoding.
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// digest streams content through the digest algorithm of a signer.
+func digest(algorithm pkix.AlgorithmIdentifier, content io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if algorithm.Algorithm.Equal(oidSHA512) {
+		h = sha512.New()
+	}
+
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// signedAttributes encodes the content type, message digest and signing time
+// as the SET OF attributes that is signed.
+func signedAttributes(messageDigest []byte, signingTime time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidMessageDigest, messageDigest},
+		{oidSigningTime, signingTime.UTC()},
+	}
+
+	attrs := make([]attribute, len(values))
+	for i, v := range values {
+		b, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attrs[i] = attribute{Type: v.oid, Values: []asn1.RawValue{{FullBytes: b}}}
+	}
+	return asn1.MarshalWithParams(attrs, "set")
+}
+
+// algorithms returns the digest and signature algorithms of a signer.
+func algorithms(alg string) (pkix.AlgorithmIdentifier, pkix.AlgorithmIdentifier, error) {
+	switch alg {
+	case lib.AlgEd25519:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA512}, pkix.AlgorithmIdentifier{Algorithm: oidEd25519}, nil
+	case lib.AlgECDSAP256:
+		return pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA2}, nil
+	}
+	return pkix.AlgorithmIdentifier{}, pkix.AlgorithmIdentifier{}, errors.New("gofze/lib/cms/cms.go: CMS needs an ed25519 or ecdsa-p256 signer")
+}
+
+// Certificate issues the self-signed certificate identifying a signer. Its
+// serial number and subject are derived from the public key.
+func Certificate(signer lib.Signer) (*x509.Certificate, error) {
+	cs, ok := signer.(lib.CryptoSigner)
+	if !ok {
+		return nil, errors.New("gofze/lib/cms/cms.go: CMS needs an ed25519 or ecdsa-p256 signer")
+	}
+
+	id := sha256.Sum256(signer.PublicKey())
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes(id[:16]),
+		Subject:      pkix.Name{CommonName: "gofze " + hex.EncodeToString(id[:8])},
+		NotBefore:    now,
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		SubjectKeyId: id[:20],
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, cs.Crypto().Public(), cs.Crypto())
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Sign returns the DER encoded detached SignedData of content.
+func Sign(signer lib.Signer, content []byte) ([]byte, error) {
+	return SignReader(signer, bytes.NewReader(content))
+}
+
+// SignReader is Sign for content read as a stream, which only enters the
+// signature through its digest.
+func SignReader(signer lib.Signer, content io.Reader) ([]byte, error) {
+	digestAlgorithm, signatureAlgorithm, err := algorithms(signer.Algorithm())
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := Certificate(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	messageDigest, err := digest(digestAlgorithm, content)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := signedAttributes(messageDigest, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Both signers hash what they sign themselves, SHA-256 for ECDSA and the
+	// internal SHA-512 of Ed25519, so the attributes are passed as they are
+	signature, err := signer.Sign(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The attributes are stored under an implicit [0] instead of the SET tag
+	raw := asn1.RawValue{}
+	if _, err := asn1.Unmarshal(attrs, &raw); err != nil {
+		return nil, err
+	}
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		EncapContentInfo: encapContentInfo{EContentType: oidData},
+		Certificates:     []asn1.RawValue{{FullBytes: cert.Raw}},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+				SerialNumber: cert.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlgorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw.Bytes},
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	}
+
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	// A RawValue is written as is, so the explicit [0] is built by hand
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
+
+// EncodePEM wraps a DER signature in a PEM block.
+func EncodePEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: der})
+}
+
+// IsCMS reports whether data looks like a PEM or DER encoded signature rather
+// than a JSON signature bundle.
+func IsCMS(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN ")) || len(data) > 0 && data[0] == 0x30
+}
+
+// Verify checks a PEM or DER encoded detached signature over content and
+// returns the certificate of its signer. The certificate is not validated
+// against any trust anchor; callers pin its public key.
+func Verify(data, content []byte) (*x509.Certificate, error) {
+	return VerifyReader(data, bytes.NewReader(content))
+}
+
+// VerifyReader is Verify for content read as a stream. Content is only held in
+// memory for signatures without signed attributes.
+func VerifyReader(data []byte, content io.Reader) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	ci := contentInfo{}
+	if rest, err := asn1.Unmarshal(data, &ci); err != nil {
+		return nil, err
+	} else if len(rest) != 0 || !ci.ContentType.Equal(oidSignedData) {
+		return nil, errors.New("gofze/lib/cms/cms.go: not a SignedData signature")
+	}
+
+	sd := signedData{}
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("gofze/lib/cms/cms.go: trailing SignedData")
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, errors.New("gofze/lib/cms/cms.go: expected a single signer")
+	}
+	si := sd.SignerInfos[0]
+
+	var cert *x509.Certificate
+	for _, raw := range sd.Certificates {
+		c, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.SerialNumber) == 0 {
+			cert = c
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("gofze/lib/cms/cms.go: signer certificate not found")
+	}
+
+	// With signed attributes the signature covers them, re-tagged as a SET,
+	// and they carry the digest of the content
+	var signed []byte
+	if len(si.SignedAttrs.FullBytes) != 0 {
+		set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+		if err != nil {
+			return nil, err
+		}
+		messageDigest, err := digest(si.DigestAlgorithm, content)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAttributes(set, messageDigest); err != nil {
+			return nil, err
+		}
+		signed = set
+	} else {
+		var err error
+		if signed, err = io.ReadAll(content); err != nil {
+			return nil, err
+		}
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case ed25519.PublicKey:
+		if !si.DigestAlgorithm.Algorithm.Equal(oidSHA512) || !si.SignatureAlgorithm.Algorithm.Equal(oidEd25519) {
+			return nil, errors.New("gofze/lib/cms/cms.go: unexpected algorithms for ed25519")
+		}
+		if !ed25519.Verify(pub, signed, si.Signature) {
+			return nil, errors.New("gofze/lib/cms/cms.go: invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !si.DigestAlgorithm.Algorithm.Equal(oidSHA256) || !si.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA2) {
+			return nil, errors.New("gofze/lib/cms/cms.go: unexpected algorithms for ecdsa")
+		}
+		d := sha256.Sum256(signed)
+		if !ecdsa.VerifyASN1(pub, d[:], si.Signature) {
+			return nil, errors.New("gofze/lib/cms/cms.go: invalid signature")
+		}
+	default:
+		return nil, errors.New("gofze/lib/cms/cms.go: unsupported signer key")
+	}
+	return cert, nil
+}
+
+// checkAttributes requires the signed attributes to describe data whose
+// digest is messageDigest.
+func checkAttributes(set, messageDigest []byte) error {
+	attrs := []attribute{}
+	if _, err := asn1.UnmarshalWithParams(set, &attrs, "set"); err != nil {
+		return err
+	}
+
+	var contentType, digest bool
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			return errors.New("gofze/lib/cms/cms.go: malformed signed attribute")
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			oid := asn1.ObjectIdentifier{}
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &oid)
+			contentType = err == nil && oid.Equal(oidData)
+		case attr.Type.Equal(oidMessageDigest):
+			d := []byte{}
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &d)
+			digest = err == nil && bytes.Equal(d, messageDigest)
+		}
+	}
+
+	if !contentType || !digest {
+		return errors.New("gofze/lib/cms/cms.go: signed attributes do not match the content")
+	}
+	return nil
+}
+
+// PublicKey returns the key of a signer certificate in the encoding of
+// lib.Signer.PublicKey, so it can be compared with a signature bundle.
+func PublicKey(cert *x509.Certificate) ([]byte, error) {
+	switch pub := cert.PublicKey.(type) {
+	case ed25519.PublicKey:
+		return pub, nil
+	case *ecdsa.PublicKey:
+		k, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		return k.Bytes(), nil
+	}
+	return nil, errors.New("gofze/lib/cms/cms.go: unsupported signer key")
+}
@@ -0,0 +1,74 @@
+package cms_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/cms"
+)
+
+func TestSignVerify(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	content := []byte("%PDF-1.4 document")
+
+	for _, alg := range []string{lib.AlgEd25519, lib.AlgECDSAP256} {
+		s, err := lib.NewSigner(alg, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		der, err := Sign(s, content)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		for _, data := range [][]byte{der, EncodePEM(der)} {
+			if !IsCMS(data) {
+				t.Errorf("%s: expected a CMS signature", alg)
+			}
+
+			cert, err := Verify(data, content)
+			if err != nil {
+				t.Fatalf("%s: %v", alg, err)
+			}
+			pub, err := PublicKey(cert)
+			if err != nil || !bytes.Equal(pub, s.PublicKey()) {
+				t.Errorf("%s: certificate does not carry the signer key", alg)
+			}
+		}
+
+		// Streamed and in-memory content produce interchangeable signatures
+		streamed, err := SignReader(s, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if _, err := Verify(streamed, content); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+		if _, err := VerifyReader(der, bytes.NewReader(content)); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+
+		if _, err := Verify(der, []byte("another document")); err == nil {
+			t.Errorf("%s: expected another document to be rejected", alg)
+		}
+
+		// Flip a byte of the signature at the end of the structure
+		der[len(der)-1] ^= 1
+		if _, err := Verify(der, content); err == nil {
+			t.Errorf("%s: expected a corrupted signature to be rejected", alg)
+		}
+	}
+}
+
+func TestSignUnsupported(t *testing.T) {
+	s, err := lib.NewSigner(lib.AlgBIP340, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Sign(s, []byte("content")); err == nil {
+		t.Error("Expected a bip340 signer to be rejected")
+	}
+}
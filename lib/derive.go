@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Purposes of the keys derived from one extracted Key. Every purpose is a
+// distinct HKDF label, so a signing and an encryption key never coincide.
+const (
+	PurposeSign    = "sign"
+	PurposeEncrypt = "encrypt"
+	PurposeMAC     = "mac"
+)
+
+// DerivedKeyLength is the size of the default purpose keys.
+const DerivedKeyLength = 32
+
+// KeySaltLength is the size of the per enrollment HKDF salt.
+const KeySaltLength = 32
+
+const deriveInfo = "gofze/derive/v1"
+
+// KeyLabel records how one purpose key is derived from the extracted Key.
+// Context binds the key to an application, such as a document or host name.
+type KeyLabel struct {
+	Label   string `json:"label"`
+	Context string `json:"context,omitempty"`
+	Length  int    `json:"length"`
+}
+
+// DefaultKeyLabels returns the signing, encryption and MAC labels bound to context.
+func DefaultKeyLabels(context string) []KeyLabel {
+	return []KeyLabel{
+		{Label: PurposeSign, Context: context, Length: DerivedKeyLength},
+		{Label: PurposeEncrypt, Context: context, Length: DerivedKeyLength},
+		{Label: PurposeMAC, Context: context, Length: DerivedKeyLength},
+	}
+}
+
+// NewKeySalt returns a fresh salt, so equal keys of different enrollments
+// still derive unrelated purpose keys.
+func NewKeySalt() []byte {
+	salt := make([]byte, KeySaltLength)
+	rand.Read(salt)
+	return salt
+}
+
+// DeriveKey expands key with HKDF-SHA256. The info string is the version tag,
+// the length prefixed label and the context, so no two labels share an input.
+func DeriveKey(key Key, salt []byte, label KeyLabel) ([]byte, error) {
+	k, err := hex.DecodeString(string(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if label.Label == "" || len(label.Label) > 255 {
+		return nil, errors.New("gofze/lib/derive.go: invalid key label")
+	}
+
+	if label.Length <= 0 || label.Length > 255*sha256.Size {
+		return nil, errors.New("gofze/lib/derive.go: invalid key length")
+	}
+
+	info := append([]byte(deriveInfo), byte(len(label.Label)))
+	info = append(info, label.Label...)
+	info = append(info, label.Context...)
+
+	derived := make([]byte, label.Length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, k, salt, info), derived); err != nil {
+		return nil, err
+	}
+	return derived, nil
+}
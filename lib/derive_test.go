@@ -0,0 +1,97 @@
+package lib_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestDeriveKey(t *testing.T) {
+	key := Key("00112233445566778899aabbccddeeff")
+	salt := NewKeySalt()
+
+	derived := map[string][]byte{}
+	for _, label := range DefaultKeyLabels("example.org") {
+		k, err := DeriveKey(key, salt, label)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(k) != DerivedKeyLength {
+			t.Errorf("%s: expected %d bytes, got %d", label.Label, DerivedKeyLength, len(k))
+		}
+		for other, k2 := range derived {
+			if bytes.Equal(k, k2) {
+				t.Errorf("%s and %s keys collide", label.Label, other)
+			}
+		}
+		derived[label.Label] = k
+	}
+
+	// The same label in another context or under another salt is unrelated
+	other, _ := DeriveKey(key, salt, KeyLabel{Label: PurposeSign, Length: DerivedKeyLength})
+	if bytes.Equal(other, derived[PurposeSign]) {
+		t.Error("Expected the context to change the key")
+	}
+	other, _ = DeriveKey(key, NewKeySalt(), KeyLabel{Label: PurposeSign, Context: "example.org", Length: DerivedKeyLength})
+	if bytes.Equal(other, derived[PurposeSign]) {
+		t.Error("Expected the salt to change the key")
+	}
+
+	if _, err := DeriveKey(key, salt, KeyLabel{Length: DerivedKeyLength}); err == nil {
+		t.Error("Expected an empty label to be rejected")
+	}
+}
+
+func TestEnrollmentDeriveKey(t *testing.T) {
+	key := Key("00112233445566778899aabbccddeeff")
+	e := &Enrollment{Helpers: []byte{1}, Salt: NewKeySalt(), Keys: DefaultKeyLabels("")}
+
+	path := filepath.Join(t.TempDir(), "enrollment.json")
+	if err := SaveEnrollment(path, e); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadEnrollment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := e.DeriveKey(key, PurposeEncrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := loaded.DeriveKey(key, PurposeEncrypt)
+	if err != nil || !bytes.Equal(k, k2) {
+		t.Error("Expected the loaded enrollment to derive the same key")
+	}
+
+	if _, err := loaded.DeriveKey(key, "unknown"); err == nil {
+		t.Error("Expected an unknown label to be rejected")
+	}
+
+	e.Keys = append(e.Keys, KeyLabel{Label: PurposeSign, Context: "again", Length: DerivedKeyLength})
+	SaveEnrollment(path, e)
+	if _, err := LoadEnrollment(path); err == nil {
+		t.Error("Expected duplicate labels to be rejected")
+	}
+}
+
+func TestEnrollmentSigner(t *testing.T) {
+	key := Key("00112233445566778899aabbccddeeff")
+	e := &Enrollment{Salt: NewKeySalt(), Keys: DefaultKeyLabels("")}
+
+	s, err := e.Signer(key, AlgECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Algorithm, e.PublicKey = s.Algorithm(), s.PublicKey()
+
+	again, err := e.Signer(key, "")
+	if err != nil || again.Algorithm() != AlgECDSAP256 || !bytes.Equal(again.PublicKey(), e.PublicKey) {
+		t.Errorf("Expected the enrolled signer, got %v", err)
+	}
+	if _, err := e.Signer(key, AlgEd25519); err == nil {
+		t.Error("Signed with another algorithm than the enrolled one")
+	}
+}
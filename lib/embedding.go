@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	mrand "math/rand/v2"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SeedLength is the size of the random-hyperplane projection seed.
+const SeedLength = 32
+
+type embeddingsource struct {
+	path string
+	bits int
+	seed []byte
+}
+
+// NewEmbeddingSource loads a float embedding (face, voice...) from a .npy or
+// .json file and binarizes it into `bits` bits with a seeded random-hyperplane
+// locality-sensitive hash, so close embeddings give close bit strings.
+func NewEmbeddingSource(path string, bits int, seed []byte) FeatureSource {
+	return &embeddingsource{
+		path: path,
+		bits: bits,
+		seed: seed,
+	}
+}
+
+func (s *embeddingsource) Features() ([]byte, error) {
+	embedding, err := LoadEmbedding(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProjectEmbedding(embedding, s.bits, s.seed)
+}
+
+func (s *embeddingsource) Length() int {
+	return s.bits / 8
+}
+
+// NewSeed draws a fresh projection seed.
+func NewSeed() []byte {
+	seed := make([]byte, SeedLength)
+	rand.Read(seed)
+	return seed
+}
+
+// ProjectEmbedding sets bit i of the result when the embedding lies on the
+// positive side of the i-th random hyperplane drawn from seed. The hyperplane
+// normals are standard normal vectors, so the chance of a bit flip between two
+// embeddings is their angle divided by pi.
+func ProjectEmbedding(embedding []float64, bits int, seed []byte) ([]byte, error) {
+	if bits <= 0 || bits%8 != 0 {
+		return nil, errors.New("gofze/lib/embedding.go: bits must be a positive multiple of 8")
+	}
+
+	if len(seed) != SeedLength {
+		return nil, errors.New("gofze/lib/embedding.go: invalid seed length")
+	}
+
+	if len(embedding) == 0 {
+		return nil, errors.New("gofze/lib/embedding.go: empty embedding")
+	}
+
+	rng := mrand.NewChaCha8([SeedLength]byte(seed))
+	projected := make([]byte, bits/8)
+	for i := range bits {
+		dot := 0.0
+		for _, x := range embedding {
+			dot += x * normal(rng)
+		}
+		if dot >= 0 {
+			projected[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return projected, nil
+}
+
+// normal draws a standard normal sample with Box-Muller. It is used instead of
+// math/rand NormFloat64 so projections stay identical across Go releases.
+func normal(rng *mrand.ChaCha8) float64 {
+	u1 := (float64(rng.Uint64()>>11) + 0.5) / (1 << 53)
+	u2 := float64(rng.Uint64()>>11) / (1 << 53)
+	return math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
+}
+
+// GenEmbedding projects an embedding with a fresh seed, locks a key to the
+// bits with fe and records the seed in the helpers for RepEmbedding.
+func GenEmbedding(fe FuzzyExtractor[byte], embedding []float64, bits int) (Key, *Helpers[byte], error) {
+	seed := NewSeed()
+	projected, err := ProjectEmbedding(embedding, bits, seed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, helpers, err := fe.Gen(hex.EncodeToString(projected))
+	if err != nil {
+		return "", nil, err
+	}
+	helpers.seed = seed
+
+	// The seed is covered by the tag of robust helpers
+	if helpers.tag != nil {
+		k, err := hex.DecodeString(string(key))
+		if err != nil {
+			return "", nil, err
+		}
+		if err := helpers.authenticate(k); err != nil {
+			return "", nil, err
+		}
+	}
+	return key, helpers, nil
+}
+
+// RepEmbedding projects an embedding with the seed stored in the helpers and
+// reproduces the key locked by GenEmbedding.
+func RepEmbedding(fe FuzzyExtractor[byte], embedding []float64, bits int, helper *Helpers[byte]) (Key, error) {
+	projected, err := ProjectEmbedding(embedding, bits, helper.seed)
+	if err != nil {
+		return "", err
+	}
+
+	return fe.Rep(hex.EncodeToString(projected), helper)
+}
+
+// BitErrorRate returns the fraction of differing bits between a and b.
+func BitErrorRate(a, b []byte) (float64, error) {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0, errors.New("gofze/lib/embedding.go: bit strings differ in length")
+	}
+
+	errs := 0
+	for i := range a {
+		for d := a[i] ^ b[i]; d != 0; d &= d - 1 {
+			errs++
+		}
+	}
+	return float64(errs) / float64(len(a)*8), nil
+}
+
+// LoadEmbedding reads a float vector from a NumPy .npy file (float32 or float64,
+// any shape, flattened) or from a .json file holding an array of numbers.
+func LoadEmbedding(file string) ([]float64, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch path.Ext(file) {
+	case ".npy":
+		return parseNpy(b)
+	case ".json":
+		var embedding []float64
+		if err := json.Unmarshal(b, &embedding); err != nil {
+			return nil, err
+		}
+		return embedding, nil
+	default:
+		return nil, errors.New("gofze/lib/embedding.go: unsupported embedding format")
+	}
+}
+
+var (
+	npyDescr   = regexp.MustCompile(`'descr':\s*'([<>|=])([fi])(\d)'`)
+	npyFortran = regexp.MustCompile(`'fortran_order':\s*True`)
+	npyShape   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+func parseNpy(b []byte) ([]float64, error) {
+	if len(b) < 10 || !bytes.HasPrefix(b, []byte("\x93NUMPY")) {
+		return nil, errors.New("gofze/lib/embedding.go: invalid npy header")
+	}
+
+	var header string
+	var data []byte
+	switch b[6] {
+	case 1:
+		n := int(binary.LittleEndian.Uint16(b[8:10]))
+		if len(b) < 10+n {
+			return nil, errors.New("gofze/lib/embedding.go: invalid npy header")
+		}
+		header, data = string(b[10:10+n]), b[10+n:]
+	case 2, 3:
+		if len(b) < 12 {
+			return nil, errors.New("gofze/lib/embedding.go: invalid npy header")
+		}
+		n := int(binary.LittleEndian.Uint32(b[8:12]))
+		if n < 0 || len(b) < 12+n {
+			return nil, errors.New("gofze/lib/embedding.go: invalid npy header")
+		}
+		header, data = string(b[12:12+n]), b[12+n:]
+	default:
+		return nil, errors.New("gofze/lib/embedding.go: unsupported npy version")
+	}
+
+	descr := npyDescr.FindStringSubmatch(header)
+	if descr == nil || descr[2] != "f" || (descr[3] != "4" && descr[3] != "8") {
+		return nil, errors.New("gofze/lib/embedding.go: npy data must be float32 or float64")
+	}
+
+	// Only the element count matters once the array is flattened, but a
+	// Fortran ordered matrix would be flattened in a different order.
+	if npyFortran.MatchString(header) {
+		return nil, errors.New("gofze/lib/embedding.go: fortran ordered npy is not supported")
+	}
+
+	shape := npyShape.FindStringSubmatch(header)
+	if shape == nil {
+		return nil, errors.New("gofze/lib/embedding.go: invalid npy shape")
+	}
+	count := 1
+	for _, dim := range strings.Split(shape[1], ",") {
+		if dim = strings.TrimSpace(dim); dim == "" {
+			continue
+		}
+		n, err := strconv.Atoi(dim)
+		if err != nil || n < 0 {
+			return nil, errors.New("gofze/lib/embedding.go: invalid npy shape")
+		}
+		count *= n
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if descr[1] == ">" {
+		order = binary.BigEndian
+	}
+
+	size, _ := strconv.Atoi(descr[3])
+	if len(data) != count*size {
+		return nil, errors.New("gofze/lib/embedding.go: npy data does not match its shape")
+	}
+
+	embedding := make([]float64, count)
+	for i := range embedding {
+		if size == 4 {
+			embedding[i] = float64(math.Float32frombits(order.Uint32(data[i*4:])))
+		} else {
+			embedding[i] = math.Float64frombits(order.Uint64(data[i*8:]))
+		}
+	}
+	return embedding, nil
+}
@@ -0,0 +1,119 @@
+package lib_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func writeNpy(t *testing.T, path string, embedding []float64) {
+	header := "{'descr': '<f4', 'fortran_order': False, 'shape': (" + strconv.Itoa(len(embedding)) + ",), }"
+	for (10+len(header)+1)%64 != 0 {
+		header += " "
+	}
+	header += "\n"
+
+	b := append([]byte("\x93NUMPY\x01\x00"), byte(len(header)), byte(len(header)>>8))
+	b = append(b, header...)
+	for _, x := range embedding {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(x)))
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func randomEmbedding(dim int) []float64 {
+	embedding := make([]float64, dim)
+	for i := range embedding {
+		embedding[i] = rand.NormFloat64()
+	}
+	return embedding
+}
+
+func TestLoadEmbedding(t *testing.T) {
+	dir := t.TempDir()
+	embedding := []float64{0.5, -1.25, 3, 0}
+
+	writeNpy(t, filepath.Join(dir, "face.npy"), embedding)
+	b, _ := json.Marshal(embedding)
+	if err := os.WriteFile(filepath.Join(dir, "face.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"face.npy", "face.json"} {
+		loaded, err := LoadEmbedding(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(loaded) != len(embedding) {
+			t.Fatalf("%s: embedding length does not match", name)
+		}
+		for i := range embedding {
+			if loaded[i] != embedding[i] {
+				t.Errorf("%s: embedding does not match", name)
+			}
+		}
+	}
+}
+
+func TestProjectEmbedding(t *testing.T) {
+	seed := NewSeed()
+	embedding := randomEmbedding(128)
+
+	a, err := ProjectEmbedding(embedding, 256, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ProjectEmbedding(embedding, 256, seed)
+	if ber, _ := BitErrorRate(a, b); ber != 0 {
+		t.Error("Projection is not deterministic")
+	}
+
+	impostor, _ := ProjectEmbedding(randomEmbedding(128), 256, seed)
+	if ber, _ := BitErrorRate(a, impostor); ber < 0.3 {
+		t.Errorf("Impostor bit-error rate too low: %f", ber)
+	}
+
+	if _, err := ProjectEmbedding(embedding, 100, seed); err == nil {
+		t.Error("Expected bits that are not a multiple of 8 to be rejected")
+	}
+}
+
+func TestEmbeddingExtractor(t *testing.T) {
+	embedding := randomEmbedding(128)
+	fe := NewDefaultFuzzyExtractor(16, 2)
+
+	key, helpers, err := GenEmbedding(fe, embedding, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scaling keeps every hyperplane side, so the projection is unchanged
+	probe := make([]float64, len(embedding))
+	for i := range embedding {
+		probe[i] = embedding[i] * 2
+	}
+
+	key2, err := RepEmbedding(fe, probe, 128, helpers)
+	if err != nil {
+		t.Fatal("Failed to reproduce key")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	if _, err := RepEmbedding(fe, randomEmbedding(128), 128, helpers); err == nil {
+		t.Error("Expected impostor embedding to be rejected")
+	}
+}
@@ -0,0 +1,158 @@
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Enrollment is the stored record of an enrollment. It describes how features
+// were read and how the extractor was sized, so a later reproduction can be set
+// up the same way, and carries the serialized Helpers or ThresholdHelpers with
+// the salt and labels of the purpose keys derived from the key. The helpers may
+// be sealed with a password or to a recipient, see SealPassword, and Robust
+// records that they are authenticated and must be reproduced as such. ID names
+// the enrollment in revocation lists, and PublicKey is the signing key it was
+// enrolled with under Algorithm.
+type Enrollment struct {
+	ID           string     `json:"id,omitempty"`
+	Algorithm    string     `json:"algorithm,omitempty"`
+	PublicKey    []byte     `json:"publicKey,omitempty"`
+	Source       string     `json:"source"`
+	Minutiae     int        `json:"minutiae,omitempty"`
+	Length       int        `json:"length"`
+	Aligned      bool       `json:"aligned,omitempty"`
+	HammingError int        `json:"hammingError"`
+	Robust       bool       `json:"robust,omitempty"`
+	Fingers      int        `json:"fingers,omitempty"`
+	Threshold    int        `json:"threshold,omitempty"`
+	Helpers      []byte     `json:"helpers"`
+	Salt         []byte     `json:"salt,omitempty"`
+	Keys         []KeyLabel `json:"keys,omitempty"`
+}
+
+// NewEnrollmentID draws a random enrollment ID.
+func NewEnrollmentID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// SaveEnrollment writes the record as JSON.
+func SaveEnrollment(path string, e *Enrollment) error {
+	b, err := MarshalEnrollment(e)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o600)
+}
+
+// MarshalEnrollment encodes the record as written by SaveEnrollment.
+func MarshalEnrollment(e *Enrollment) ([]byte, error) {
+	return json.MarshalIndent(e, "", "  ")
+}
+
+// LoadEnrollment reads a record written by SaveEnrollment.
+func LoadEnrollment(path string) (*Enrollment, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEnrollment(b)
+}
+
+// ParseEnrollment decodes and checks a record encoded by MarshalEnrollment.
+func ParseEnrollment(b []byte) (*Enrollment, error) {
+	e := &Enrollment{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+
+	if len(e.Helpers) == 0 {
+		return nil, errors.New("gofze/lib/enrollment.go: enrollment has no helpers")
+	}
+
+	labels := map[string]bool{}
+	for _, k := range e.Keys {
+		if labels[k.Label] {
+			return nil, errors.New("gofze/lib/enrollment.go: duplicate key label " + k.Label)
+		}
+		labels[k.Label] = true
+	}
+	return e, nil
+}
+
+// DeriveKey derives the purpose key recorded under label from the reproduced
+// key. Records without key labels derive the default labels with no context.
+func (e *Enrollment) DeriveKey(key Key, label string) ([]byte, error) {
+	keys := e.Keys
+	if len(keys) == 0 {
+		keys = DefaultKeyLabels("")
+	}
+
+	for _, k := range keys {
+		if k.Label == label {
+			return DeriveKey(key, e.Salt, k)
+		}
+	}
+	return nil, errors.New("gofze/lib/enrollment.go: no key labelled " + label)
+}
+
+// Extractor sizes the extractor the record was enrolled with, requiring
+// authenticated helpers when it was enrolled robust. Helpers flagged robust
+// are reproduced as such by any extractor, so clearing Robust does not turn
+// off their checks.
+func (e *Enrollment) Extractor() MaskedFuzzyExtractor[uint32] {
+	if e.Robust {
+		return NewDefaultRobustFuzzyExtractor[uint32](e.Length/4, e.HammingError)
+	}
+	return NewDefaultFuzzy32Extractor(e.Length/4, e.HammingError)
+}
+
+// Signer derives the signing key of the record from its reproduced key, for
+// alg or else the algorithm it was enrolled with. Records holding a public key
+// only sign with their enrolled algorithm, so the key that is trusted and
+// revoked is the only one they have.
+func (e *Enrollment) Signer(key Key, alg string) (Signer, error) {
+	if len(e.PublicKey) > 0 && alg != "" && alg != e.Algorithm {
+		return nil, errors.New("gofze/lib/enrollment.go: enrollment signs with " + e.Algorithm + ", not " + alg)
+	}
+	if alg == "" {
+		alg = e.Algorithm
+	}
+	if alg == "" {
+		alg = AlgEd25519
+	}
+
+	signKey, err := e.DeriveKey(key, PurposeSign)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(alg, signKey)
+}
+
+// ParamsHash is the SHA-256 of the extractor parameters of the record, leaving
+// out its identity, helpers and keys, so signatures can name the setup that
+// made them without revealing the helpers.
+func (e *Enrollment) ParamsHash() []byte {
+	params := *e
+	params.ID, params.Algorithm, params.PublicKey = "", "", nil
+	params.Helpers, params.Salt, params.Keys = nil, nil, nil
+
+	b, _ := json.Marshal(params)
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// OpenHelpers returns the serialized helpers of the record, decrypting them
+// with c when they were sealed.
+func (e *Enrollment) OpenHelpers(c Credential) ([]byte, error) {
+	if !IsSealed(e.Helpers) {
+		return e.Helpers, nil
+	}
+	return Open(e.Helpers, c)
+}
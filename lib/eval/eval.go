@@ -0,0 +1,269 @@
+// Package eval measures the biometric performance of the fuzzy extractor over a
+// corpus of captures grouped by subject, such as the tc/ images named 103_N and
+// 106_N. Every capture is enrolled and reproduced against every other capture;
+// pairs of the same subject are genuine attempts and all others are impostor
+// attempts.
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// Sample is one capture of a subject.
+type Sample struct {
+	Subject string
+	Path    string
+}
+
+// Params is one operating point of the extractor.
+type Params struct {
+	HammingError   int
+	ReproduceError float64
+}
+
+// Result holds the error rates measured at one operating point.
+type Result struct {
+	Params
+	Genuine           int
+	Impostor          int
+	FalseRejects      int
+	FalseAccepts      int
+	FailuresToAcquire int
+	FAR               float64
+	FRR               float64
+}
+
+// Config selects how captures are read and which operating points are swept.
+type Config struct {
+	Source  func(path string) lib.FeatureSource
+	Params  []Params
+	Workers int
+}
+
+var sampleName = regexp.MustCompile(`^(.+)_(\d+)\.\w+$`)
+
+// LoadCorpus lists the captures in dir named <subject>_<n>.<ext>.
+func LoadCorpus(dir string) ([]Sample, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []Sample{}
+	for _, entry := range entries {
+		match := sampleName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		samples = append(samples, Sample{
+			Subject: match[1],
+			Path:    filepath.Join(dir, entry.Name()),
+		})
+	}
+
+	if len(samples) < 2 {
+		return nil, errors.New("gofze/lib/eval/eval.go: corpus needs at least two captures")
+	}
+	return samples, nil
+}
+
+// Grid returns every combination of the given hamming and reproduce errors.
+func Grid(hammingErrors []int, reproduceErrors []float64) []Params {
+	params := []Params{}
+	for _, hammingError := range hammingErrors {
+		for _, reproduceError := range reproduceErrors {
+			params = append(params, Params{hammingError, reproduceError})
+		}
+	}
+	return params
+}
+
+// Run reads every sample once, then for every operating point enrolls each
+// sample and tries to reproduce its key from every other sample.
+func Run(samples []Sample, config Config) ([]Result, error) {
+	if config.Source == nil || len(config.Params) == 0 {
+		return nil, errors.New("gofze/lib/eval/eval.go: missing source or parameters")
+	}
+
+	workers := config.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// Captures that cannot be read stay empty and count as failures to acquire
+	values := make([]string, len(samples))
+	length := 0
+	failures := 0
+	for i, sample := range samples {
+		source := config.Source(sample.Path)
+		features, err := source.Features()
+		if err != nil {
+			failures++
+			continue
+		}
+		values[i] = hex.EncodeToString(features)
+		length = source.Length()
+	}
+
+	if length == 0 || length%4 != 0 {
+		return nil, errors.New("gofze/lib/eval/eval.go: no usable captures")
+	}
+
+	results := make([]Result, len(config.Params))
+	for p, params := range config.Params {
+		fe := lib.NewFuzzy32Extractor(length/4, params.HammingError, params.ReproduceError, 2, 16)
+		result := Result{Params: params, FailuresToAcquire: failures}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		jobs := make(chan int)
+		for range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					r := attempt(fe, samples, values, i)
+					mu.Lock()
+					result.Genuine += r.Genuine
+					result.Impostor += r.Impostor
+					result.FalseRejects += r.FalseRejects
+					result.FalseAccepts += r.FalseAccepts
+					mu.Unlock()
+				}
+			}()
+		}
+		for i := range samples {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		if result.Genuine > 0 {
+			result.FRR = float64(result.FalseRejects) / float64(result.Genuine)
+		}
+		if result.Impostor > 0 {
+			result.FAR = float64(result.FalseAccepts) / float64(result.Impostor)
+		}
+		results[p] = result
+	}
+	return results, nil
+}
+
+// attempt enrolls sample i and reproduces it from every other sample.
+func attempt(fe lib.FuzzyExtractor[uint32], samples []Sample, values []string, i int) Result {
+	r := Result{}
+	var key lib.Key
+	var helpers *lib.Helpers[uint32]
+	if values[i] != "" {
+		var err error
+		if key, helpers, err = fe.Gen(values[i]); err != nil {
+			helpers = nil
+		}
+	}
+
+	for j := range samples {
+		if i == j {
+			continue
+		}
+
+		genuine := samples[i].Subject == samples[j].Subject
+		accepted := false
+		if helpers != nil && values[j] != "" {
+			reproduced, err := fe.Rep(values[j], helpers)
+			accepted = err == nil && reproduced == key
+		}
+
+		if genuine {
+			r.Genuine++
+			if !accepted {
+				r.FalseRejects++
+			}
+		} else {
+			r.Impostor++
+			if accepted {
+				r.FalseAccepts++
+			}
+		}
+	}
+	return r
+}
+
+// EqualErrorRate estimates the rate at which FAR equals FRR by interpolating
+// between the operating points around the crossing, ordered by FAR. When the
+// curves never cross it returns the midpoint of the closest operating point.
+// The operating point closest to the equal error rate is returned with it.
+func EqualErrorRate(results []Result) (float64, Result) {
+	if len(results) == 0 {
+		return 0, Result{}
+	}
+
+	sorted := append([]Result{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FAR != sorted[j].FAR {
+			return sorted[i].FAR < sorted[j].FAR
+		}
+		return sorted[i].FRR > sorted[j].FRR
+	})
+
+	closest := sorted[0]
+	for _, r := range sorted {
+		if abs(r.FAR-r.FRR) < abs(closest.FAR-closest.FRR) {
+			closest = r
+		}
+	}
+
+	for i := 0; i+1 < len(sorted); i++ {
+		a, b := sorted[i], sorted[i+1]
+		da, db := a.FRR-a.FAR, b.FRR-b.FAR
+		if da >= 0 && db <= 0 && da != db {
+			t := da / (da - db)
+			return a.FAR + t*(b.FAR-a.FAR), closest
+		}
+	}
+	return (closest.FAR + closest.FRR) / 2, closest
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// WriteCSV writes one row per operating point. Plotting FRR against FAR gives
+// the DET curve and TAR (1 - FRR) against FAR gives the ROC curve.
+func WriteCSV(w io.Writer, results []Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"hamming_error", "reproduce_error", "genuine", "impostor",
+		"false_rejects", "false_accepts", "far", "frr", "tar",
+	})
+
+	for _, r := range results {
+		cw.Write([]string{
+			strconv.Itoa(r.HammingError),
+			strconv.FormatFloat(r.ReproduceError, 'g', -1, 64),
+			strconv.Itoa(r.Genuine),
+			strconv.Itoa(r.Impostor),
+			strconv.Itoa(r.FalseRejects),
+			strconv.Itoa(r.FalseAccepts),
+			strconv.FormatFloat(r.FAR, 'f', 6, 64),
+			strconv.FormatFloat(r.FRR, 'f', 6, 64),
+			strconv.FormatFloat(1-r.FRR, 'f', 6, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,83 @@
+package eval_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/eval"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	for _, subject := range []string{"201", "202", "203"} {
+		template := make([]byte, 16)
+		rand.Read(template)
+		for n := range 3 {
+			capture := bytes.Clone(template)
+			capture[n] ^= 0x01 // one bit of noise per capture
+			os.WriteFile(filepath.Join(dir, subject+"_"+string(rune('1'+n))+".bin"), capture, 0o600)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "README"), nil, 0o600)
+
+	samples, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 9 {
+		t.Fatalf("Expected 9 samples, got %d", len(samples))
+	}
+
+	results, err := Run(samples, Config{
+		Source: func(path string) lib.FeatureSource { return lib.NewTemplateSource(path, 16) },
+		Params: Grid([]int{1, 3}, []float64{0.01}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range results {
+		if r.Genuine != 18 || r.Impostor != 54 {
+			t.Errorf("Unexpected attempt counts: %+v", r)
+		}
+		if r.FAR != 0 {
+			t.Errorf("Random impostors were accepted: %+v", r)
+		}
+	}
+
+	if results[1].FRR > 0.2 {
+		t.Errorf("FRR too high for hamming error 3: %f", results[1].FRR)
+	}
+
+	var csv strings.Builder
+	if err := WriteCSV(&csv, results); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(csv.String(), "hamming_error,reproduce_error,") || strings.Count(csv.String(), "\n") != 3 {
+		t.Errorf("Unexpected CSV:\n%s", csv.String())
+	}
+}
+
+func TestEqualErrorRate(t *testing.T) {
+	results := []Result{
+		{FAR: 0.0, FRR: 0.4},
+		{FAR: 0.1, FRR: 0.2},
+		{FAR: 0.3, FRR: 0.0},
+	}
+
+	eer, closest := EqualErrorRate(results)
+	if math.Abs(eer-0.15) > 1e-9 {
+		t.Errorf("Expected EER 0.15, got %f", eer)
+	}
+
+	if closest.FAR != 0.1 {
+		t.Errorf("Unexpected closest operating point: %+v", closest)
+	}
+}
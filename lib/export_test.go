@@ -0,0 +1,12 @@
+package lib
+
+import "io"
+
+// WithRandom swaps the randomness of an extractor so known-answer tests can
+// replay Gen deterministically.
+func WithRandom[T Number](fe FuzzyExtractor[T], random io.Reader) FuzzyExtractor[T] {
+	if fz, ok := any(fe).(*fuzzyextractor[T]); ok {
+		fz.random = random
+	}
+	return fe
+}
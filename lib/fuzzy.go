@@ -3,9 +3,11 @@ package lib
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"hash"
+	"io"
 	"math"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -22,16 +24,39 @@ type Helpers[T Number] struct {
 	ciphers		[][]T
 	masks		[][]T
 	nonces		[][]T
+	sample		[]T		// Bits lockers may sample, nil when all bits may be
+	seed		[]byte	// Projection seed of embedding sources, if any
+	tag			[]byte	// MAC of robust helpers, see robust.go
+	robust		bool	// Reproduced as robust by every extractor
 }
 
-type fuzzyextractor struct {
+// KDFParams configures the PBKDF2 digest that locks every key copy.
+type KDFParams struct {
+	Hash		func() hash.Hash
+	Iterations	int
+}
+
+// DefaultKDF is the single iteration PBKDF2-SHA256 used by the default extractors.
+var DefaultKDF = KDFParams{Hash: sha256.New, Iterations: 1}
+
+// fuzzyextractor is the single engine behind every word width. Values, masks
+// and keys are big endian words of T, and the lockers hash their byte encoding,
+// so an extractor over n words of T is interchangeable with one over the same
+// bits in any other width except for the number of lockers. Every locker reuses
+// the same scratch buffers for its vector, nonce and digest, and the helper
+// words of all lockers share one backing array per kind.
+type fuzzyextractor[T Number] struct {
 	hash			func() hash.Hash
+	iterations		int
 	securityLength	int
 	nonceLength		int
 	blockLength		int
 	hammingError	int
 	reproduceError	float64
 	numHelpers		int
+	robust			bool
+	random			io.Reader
+	progress		func(done, total int)
 }
 
 type FuzzyExtractor[T Number] interface {
@@ -39,36 +64,78 @@ type FuzzyExtractor[T Number] interface {
 	Rep(value string, helper *Helpers[T]) (Key, error)
 }
 
-func sum[T Number](input ...T) int {
-	result := 0
-	for _, b := range input {
-		result += int(b)
+// ProgressExtractor reports how many lockers Gen has made, so callers can show
+// progress on long runs, e.g. with a costly KDF.
+type ProgressExtractor interface {
+	SetProgress(progress func(done, total int))
+}
+
+// MaskedFuzzyExtractor restricts the bits sampled by every locker to the set
+// bits of a hex encoded mask, such as the occlusion mask of an iris code. The
+// mask is recorded in the helpers so Rep samples the same positions.
+type MaskedFuzzyExtractor[T Number] interface {
+	FuzzyExtractor[T]
+	GenMasked(value, mask string) (Key, *Helpers[T], error)
+}
+
+// fits reports whether the helpers were generated for the given lengths, so
+// helpers loaded from storage cannot index past the extractor's buffers.
+func (h *Helpers[T]) fits(blockLength, securityLength, nonceLength int) bool {
+	if h == nil || len(h.ciphers) == 0 || len(h.masks) != len(h.ciphers) || len(h.nonces) != len(h.ciphers) {
+		return false
+	}
+	if h.sample != nil && len(h.sample) != blockLength {
+		return false
 	}
-	return result
+	for i := range h.ciphers {
+		if len(h.ciphers[i]) != blockLength + securityLength || len(h.masks[i]) != blockLength || len(h.nonces[i]) != nonceLength {
+			return false
+		}
+	}
+	return true
 }
 
-func NewFuzzyExtractor(blockLength, hammingError int,  reproduceError float64, securityLength, nonceLength int) FuzzyExtractor[byte] {
-	return &fuzzyextractor{
-		hash: sha256.New,
+// Lockers returns the number of key copies locked in the helpers.
+func (h *Helpers[T]) Lockers() int {
+	return len(h.ciphers)
+}
+
+func newFuzzyExtractor[T Number](blockLength, hammingError int,  reproduceError float64, securityLength, nonceLength int, kdf KDFParams) *fuzzyextractor[T] {
+	return &fuzzyextractor[T]{
+		hash: kdf.Hash,
+		iterations: kdf.Iterations,
 		securityLength: securityLength,
 		nonceLength: nonceLength,
 		blockLength: blockLength,
 		hammingError: hammingError,
 		reproduceError: reproduceError,
-		numHelpers: getNumHelpers(8, blockLength, hammingError, reproduceError),
+		numHelpers: getNumHelpers(width[T]() * 8, blockLength, hammingError, reproduceError),
+		random: rand.Reader,
 	}
 }
 
-func NewDefaultFuzzyExtractor(blockLength, hammingError int) FuzzyExtractor[byte] {
-	return &fuzzyextractor{
-		hash: sha256.New,
-		securityLength: 2,
-		nonceLength: 16,
-		blockLength: blockLength,
-		hammingError: hammingError,
-		reproduceError: 0.001,
-		numHelpers: getNumHelpers(8, blockLength, hammingError, 0.001),
-	}
+// NewGenericFuzzyExtractor builds an extractor over blockLength words of any
+// unsigned width, e.g. NewGenericFuzzyExtractor[uint64](2, 4, 0.001, 2, 16, DefaultKDF).
+func NewGenericFuzzyExtractor[T Number](blockLength, hammingError int,  reproduceError float64, securityLength, nonceLength int, kdf KDFParams) MaskedFuzzyExtractor[T] {
+	return newFuzzyExtractor[T](blockLength, hammingError, reproduceError, securityLength, nonceLength, kdf)
+}
+
+func NewDefaultGenericFuzzyExtractor[T Number](blockLength, hammingError int) MaskedFuzzyExtractor[T] {
+	return newFuzzyExtractor[T](blockLength, hammingError, 0.001, 2, 16, DefaultKDF)
+}
+
+func NewFuzzyExtractor(blockLength, hammingError int,  reproduceError float64, securityLength, nonceLength int) MaskedFuzzyExtractor[byte] {
+	return newFuzzyExtractor[byte](blockLength, hammingError, reproduceError, securityLength, nonceLength, DefaultKDF)
+}
+
+func NewDefaultFuzzyExtractor(blockLength, hammingError int) MaskedFuzzyExtractor[byte] {
+	return newFuzzyExtractor[byte](blockLength, hammingError, 0.001, 2, 16, DefaultKDF)
+}
+
+// NewFuzzyExtractorWithKDF is NewFuzzyExtractor with a custom locker KDF, trading
+// Gen/Rep time for the cost of brute forcing a single locker offline.
+func NewFuzzyExtractorWithKDF(blockLength, hammingError int,  reproduceError float64, securityLength, nonceLength int, kdf KDFParams) MaskedFuzzyExtractor[byte] {
+	return newFuzzyExtractor[byte](blockLength, hammingError, reproduceError, securityLength, nonceLength, kdf)
 }
 
 func getNumHelpers(blockSize, blockLength, hammingError int, reproduceError float64) int {
@@ -77,81 +144,235 @@ func getNumHelpers(blockSize, blockLength, hammingError int, reproduceError floa
 	return int(math.Round(math.Pow(n, c) * math.Log2(float64(2) / reproduceError)))
 }
 
-func (fz *fuzzyextractor) Gen(value string) (Key, *Helpers[byte], error) {
-	val, err := hex.DecodeString(value)
+func (fz *fuzzyextractor[T]) Gen(value string) (Key, *Helpers[T], error) {
+	val, err := fz.decode(value)
 	if err != nil {
 		return "", nil, err
 	}
 
-	if len(val) != fz.blockLength {
-		return "", nil, errors.New("gofze/lib/fuzzy.go: invalid value length")
+	return fz.gen(val, nil)
+}
+
+func (fz *fuzzyextractor[T]) GenMasked(value, mask string) (Key, *Helpers[T], error) {
+	val, err := fz.decode(value)
+	if err != nil {
+		return "", nil, err
 	}
 
-	key := make([]byte, fz.blockLength)
-	rand.Read(key)
-	pad := make([]byte, fz.securityLength)
-	keyPad := append(key, pad...)
+	sample, err := fz.decode(mask)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if zero(sample) {
+		return "", nil, errors.New("gofze/lib/fuzzy.go: empty sampling mask")
+	}
 
-	nonces  := make([][]byte, fz.numHelpers)
-	masks   := make([][]byte, fz.numHelpers)
-	vectors := make([][]byte, fz.numHelpers)
-	digests := make([][]byte, fz.numHelpers)
-	ciphers := make([][]byte, fz.numHelpers)
+	return fz.gen(val, sample)
+}
+
+// decode reads a hex encoded value of blockLength words.
+func (fz *fuzzyextractor[T]) decode(value string) ([]T, error) {
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) != fz.blockLength * width[T]() {
+		return nil, errors.New("gofze/lib/fuzzy.go: invalid value length")
+	}
+
+	return toWords[T](b), nil
+}
+
+// SetProgress has Gen call progress after every locker it makes.
+func (fz *fuzzyextractor[T]) SetProgress(progress func(done, total int)) {
+	fz.progress = progress
+}
+
+// gen locks a fresh key behind lockers sampling val, restricted to the set
+// bits of sample when it is not nil.
+func (fz *fuzzyextractor[T]) gen(val, sample []T) (Key, *Helpers[T], error) {
+	w := width[T]()
+	cipherLength := fz.blockLength + fz.securityLength
+
+	minWeight := fz.minWeight()
+	if fz.robust && sample != nil && weight(sample) < 2 * minWeight {
+		return "", nil, errors.New("gofze/lib/fuzzy.go: sampling mask too sparse for robust helpers")
+	}
+
+	key := make([]byte, fz.blockLength * w)
+	if _, err := io.ReadFull(fz.random, key); err != nil {
+		return "", nil, err
+	}
+	keyPad := make([]T, cipherLength)
+	copy(keyPad, toWords[T](key))
+
+	nonces  := make([][]T, fz.numHelpers)
+	masks   := make([][]T, fz.numHelpers)
+	ciphers := make([][]T, fz.numHelpers)
+	nonceWords  := make([]T, fz.numHelpers * fz.nonceLength)
+	maskWords   := make([]T, fz.numHelpers * fz.blockLength)
+	cipherWords := make([]T, fz.numHelpers * cipherLength)
+
+	nonce8  := make([]byte, fz.nonceLength * w)
+	mask8   := make([]byte, fz.blockLength * w)
+	vector8 := make([]byte, fz.blockLength * w)
 
 	for i := range fz.numHelpers {
-		nonces[i] = make([]byte, fz.nonceLength)
-		rand.Read(nonces[i])
-		masks[i] = make([]byte, fz.blockLength)
-		rand.Read(masks[i])
-		vectors[i] = make([]byte, fz.blockLength)
+		if _, err := io.ReadFull(fz.random, nonce8); err != nil {
+			return "", nil, err
+		}
+		nonces[i] = nonceWords[i * fz.nonceLength : (i + 1) * fz.nonceLength : (i + 1) * fz.nonceLength]
+		for j := range fz.nonceLength {
+			nonces[i][j] = getWord[T](nonce8[j * w:])
+		}
+
+		// Robust lockers are redrawn until they sample enough bits
+		masks[i] = maskWords[i * fz.blockLength : (i + 1) * fz.blockLength : (i + 1) * fz.blockLength]
+		for first := true; first || fz.robust && weight(masks[i]) < minWeight; first = false {
+			if _, err := io.ReadFull(fz.random, mask8); err != nil {
+				return "", nil, err
+			}
+			for j := range fz.blockLength {
+				masks[i][j] = getWord[T](mask8[j * w:])
+				if sample != nil {
+					masks[i][j] &= sample[j]
+				}
+			}
+		}
 		for j := range fz.blockLength {
-			vectors[i][j] = val[j] & masks[i][j]
+			putWord(vector8[j * w:], val[j] & masks[i][j])
+		}
+
+		digest8 := pbkdf2.Key(vector8, nonce8, fz.iterations, cipherLength * w, fz.hash)
+		ciphers[i] = cipherWords[i * cipherLength : (i + 1) * cipherLength : (i + 1) * cipherLength]
+		for j := range cipherLength {
+			ciphers[i][j] = getWord[T](digest8[j * w:]) ^ keyPad[j]
 		}
-		digests[i] = pbkdf2.Key(vectors[i], nonces[i], 1, fz.blockLength + fz.securityLength, fz.hash)
-		ciphers[i] = make([]byte, fz.blockLength + fz.securityLength)
-		for j := range fz.blockLength + fz.securityLength {
-			ciphers[i][j] = digests[i][j] ^ keyPad[j]
+		if fz.progress != nil {
+			fz.progress(i + 1, fz.numHelpers)
 		}
 	}
 
-	return Key(hex.EncodeToString(key)), &Helpers[byte]{
+	helpers := &Helpers[T]{
 		ciphers: ciphers,
 		masks: masks,
 		nonces: nonces,
-	}, nil
+		sample: sample,
+	}
+	if fz.robust {
+		helpers.robust = true
+		if err := helpers.authenticate(key); err != nil {
+			return "", nil, err
+		}
+	}
+	return Key(hex.EncodeToString(key)), helpers, nil
 }
 
-func (fz *fuzzyextractor) Rep(value string, helper *Helpers[byte]) (Key, error) {
-	val, err := hex.DecodeString(value)
+func (fz *fuzzyextractor[T]) Rep(value string, helper *Helpers[T]) (Key, error) {
+	val, err := fz.decode(value)
 	if err != nil {
 		return "", err
 	}
 
-	if len(val) != fz.blockLength {
-		return "", errors.New("gofze/lib/fuzzy.go: invalid value length")
+	if !helper.fits(fz.blockLength, fz.securityLength, fz.nonceLength) {
+		return "", errors.New("gofze/lib/fuzzy.go: malformed helpers")
 	}
 
-	ciphers := helper.ciphers
-	masks := helper.masks
-	nonces := helper.nonces
-	vectors := make([][]byte, fz.numHelpers)
-	digests := make([][]byte, fz.numHelpers)
-	plains := make([][]byte, fz.numHelpers)
+	if fz.robust || helper.robust {
+		if err := helper.checkRobust(fz.minWeight()); err != nil {
+			return "", err
+		}
+	}
 
-	for i := range fz.numHelpers {
-		vectors[i] = make([]byte, fz.blockLength)
+	if helper.sample != nil {
 		for j := range fz.blockLength {
-			vectors[i][j] = masks[i][j] & val[j]
+			val[j] &= helper.sample[j]
 		}
-		digests[i] = pbkdf2.Key(vectors[i], nonces[i], 1, fz.blockLength + fz.securityLength, fz.hash)
-		plains[i] = make([]byte, fz.blockLength + fz.securityLength)
-		for j := range fz.blockLength + fz.securityLength {
-			plains[i][j] = digests[i][j] ^ ciphers[i][j]
+	}
+
+	w := width[T]()
+	cipherLength := fz.blockLength + fz.securityLength
+	nonce8  := make([]byte, fz.nonceLength * w)
+	vector8 := make([]byte, fz.blockLength * w)
+
+	for i, cipher := range helper.ciphers {
+		for j := range fz.blockLength {
+			putWord(vector8[j * w:], helper.masks[i][j] & val[j])
+		}
+		for j := range fz.nonceLength {
+			putWord(nonce8[j * w:], helper.nonces[i][j])
+		}
+
+		digest8 := pbkdf2.Key(vector8, nonce8, fz.iterations, cipherLength * w, fz.hash)
+		padded := true
+		for j := fz.blockLength; j < cipherLength; j++ {
+			if getWord[T](digest8[j * w:]) ^ cipher[j] != 0 {
+				padded = false
+				break
+			}
 		}
-		if sum(plains[i][fz.blockLength:]...) == 0 {
-			return Key(hex.EncodeToString(plains[i][:fz.blockLength])), nil
+		if padded {
+			// Decrypt the key in place of the digest it was masked with
+			for j := range fz.blockLength {
+				putWord(digest8[j * w:], getWord[T](digest8[j * w:]) ^ cipher[j])
+			}
+			key := digest8[:fz.blockLength * w]
+			if helper.tag != nil {
+				if err := helper.check(key); err != nil {
+					return "", err
+				}
+			}
+			return Key(hex.EncodeToString(key)), nil
 		}
 	}
 
 	return "", errors.New("gofze/lib/fuzzy.go: unable to reproduce key")
-}
\ No newline at end of file
+}
+
+func zero[T Number](words []T) bool {
+	for _, word := range words {
+		if word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// getWord reads a big endian word of T from the front of b.
+func getWord[T Number](b []byte) T {
+	switch width[T]() {
+	case 1:
+		return T(b[0])
+	case 2:
+		return T(binary.BigEndian.Uint16(b))
+	case 4:
+		return T(binary.BigEndian.Uint32(b))
+	}
+	return T(binary.BigEndian.Uint64(b))
+}
+
+// putWord writes word big endian to the front of b.
+func putWord[T Number](b []byte, word T) {
+	switch width[T]() {
+	case 1:
+		b[0] = byte(word)
+	case 2:
+		binary.BigEndian.PutUint16(b, uint16(word))
+	case 4:
+		binary.BigEndian.PutUint32(b, uint32(word))
+	default:
+		binary.BigEndian.PutUint64(b, uint64(word))
+	}
+}
+
+// toWords reads big endian words, ignoring a trailing partial word.
+func toWords[T Number](b []byte) []T {
+	w := width[T]()
+	words := make([]T, len(b) / w)
+	for i := range words {
+		words[i] = getWord[T](b[i * w:])
+	}
+	return words
+}
@@ -31,4 +31,27 @@ func TestFuzzy32Extractor(t *testing.T) {
 	if key != key2 {
 		t.Error("Key and reproduced key do not match")
 	}
-}
\ No newline at end of file
+}
+
+func TestFuzzy32ExtractorMasked(t *testing.T) {
+	fe := NewDefaultFuzzy32Extractor(4, 2)
+
+	key, helpers, err := fe.GenMasked("00112233445566778899aabbccddeeff", "ffffffff000000000000000000000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first word is sampled, so the remaining words may differ freely
+	key2, err := fe.Rep("00112233ffffffffffffffffffffffff", helpers)
+	if err != nil {
+		t.Error("Failed to reproduce key")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	if _, _, err := fe.GenMasked("00112233445566778899aabbccddeeff", "00000000000000000000000000000000"); err == nil {
+		t.Error("Expected empty sampling mask to be rejected")
+	}
+}
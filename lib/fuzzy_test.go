@@ -29,4 +29,32 @@ func TestFuzzyExtractor(t *testing.T) {
 	if key != key2 {
 		t.Error("Key and reproduced key do not match")
 	}
-}
\ No newline at end of file
+}
+
+func TestGenericFuzzyExtractor(t *testing.T) {
+	fe := NewDefaultGenericFuzzyExtractor[uint64](2, 1)
+
+	key, helpers, err := fe.Gen("00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Helpers[uint64]{}
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := fe.Rep("00112233445566778899abbbccddeeff", restored)
+	if err != nil || key != key2 {
+		t.Error("Failed to reproduce key from restored helpers")
+	}
+
+	if _, err := fe.Rep("00112233445566778899aabbccddee", restored); err == nil {
+		t.Error("Expected a partial word to be rejected")
+	}
+}
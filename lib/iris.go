@@ -0,0 +1,125 @@
+package lib
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// Iris codes are 2048 bit strings followed by an occlusion mask of the same
+// size, where a set mask bit marks a usable code bit (no eyelid, lash or glare).
+const (
+	IrisCodeBits  = 2048
+	IrisCodeBytes = IrisCodeBits / 8
+)
+
+type irissource struct {
+	path string
+}
+
+type irisextractor struct {
+	fe       MaskedFuzzyExtractor[byte]
+	maxShift int
+}
+
+// NewIrisSource reads an iris code file holding the raw code followed by its
+// occlusion mask, returning both as one IrisCodeBytes * 2 long vector.
+func NewIrisSource(path string) FeatureSource {
+	return &irissource{path: path}
+}
+
+// NewIrisExtractor locks keys to iris codes given as the hex encoded vectors of
+// an iris source. Occluded bits are never sampled, and Rep retries the reading
+// cyclically shifted by up to maxShift bits either way to absorb eye rotation.
+func NewIrisExtractor(hammingError, maxShift int, reproduceError float64, securityLength, nonceLength int) FuzzyExtractor[byte] {
+	return &irisextractor{
+		fe:       NewFuzzyExtractor(IrisCodeBytes, hammingError, reproduceError, securityLength, nonceLength),
+		maxShift: maxShift,
+	}
+}
+
+func NewDefaultIrisExtractor(hammingError, maxShift int) FuzzyExtractor[byte] {
+	return &irisextractor{
+		fe:       NewDefaultFuzzyExtractor(IrisCodeBytes, hammingError),
+		maxShift: maxShift,
+	}
+}
+
+func (s *irissource) Features() ([]byte, error) {
+	features, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(features) != s.Length() {
+		return nil, errors.New("gofze/lib/iris.go: invalid iris code length")
+	}
+	return features, nil
+}
+
+func (s *irissource) Length() int {
+	return IrisCodeBytes * 2
+}
+
+func (ie *irisextractor) Gen(value string) (Key, *Helpers[byte], error) {
+	code, mask, err := splitIrisCode(value)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return ie.fe.GenMasked(hex.EncodeToString(code), hex.EncodeToString(mask))
+}
+
+// Rep tries the unshifted code first, then alternates between left and right
+// shifts of growing size so the most likely alignments are tried early.
+func (ie *irisextractor) Rep(value string, helper *Helpers[byte]) (Key, error) {
+	code, _, err := splitIrisCode(value)
+	if err != nil {
+		return "", err
+	}
+
+	shifts := []int{0}
+	for shift := 1; shift <= ie.maxShift; shift++ {
+		shifts = append(shifts, -shift, shift)
+	}
+
+	for _, shift := range shifts {
+		key, err := ie.fe.Rep(hex.EncodeToString(RotateBits(code, shift)), helper)
+		if err == nil {
+			return key, nil
+		}
+	}
+
+	return "", errors.New("gofze/lib/iris.go: unable to reproduce key")
+}
+
+func splitIrisCode(value string) ([]byte, []byte, error) {
+	val, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(val) != IrisCodeBytes*2 {
+		return nil, nil, errors.New("gofze/lib/iris.go: invalid iris code length")
+	}
+	return val[:IrisCodeBytes], val[IrisCodeBytes:], nil
+}
+
+// RotateBits cyclically rotates a big endian bit string left by shift bits,
+// or right when shift is negative.
+func RotateBits(value []byte, shift int) []byte {
+	n := len(value) * 8
+	rotated := make([]byte, len(value))
+	if n == 0 {
+		return rotated
+	}
+
+	shift = ((shift % n) + n) % n
+	for i := range n {
+		j := (i + shift) % n
+		if value[j/8]>>(7-j%8)&1 == 1 {
+			rotated[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return rotated
+}
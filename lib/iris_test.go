@@ -0,0 +1,73 @@
+package lib_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestRotateBits(t *testing.T) {
+	value := []byte{0b10000000, 0b00000001}
+
+	if !bytes.Equal(RotateBits(value, 1), []byte{0b00000000, 0b00000011}) {
+		t.Error("Left rotation does not match")
+	}
+
+	if !bytes.Equal(RotateBits(value, -1), []byte{0b11000000, 0b00000000}) {
+		t.Error("Right rotation does not match")
+	}
+
+	if !bytes.Equal(RotateBits(RotateBits(value, 5), -5), value) {
+		t.Error("Rotation is not reversible")
+	}
+}
+
+func TestIrisExtractor(t *testing.T) {
+	code := make([]byte, IrisCodeBytes)
+	rand.Read(code)
+	mask := bytes.Repeat([]byte{0xff}, IrisCodeBytes)
+	for i := range 32 {
+		mask[i] = 0 // eyelid covering the first 256 bits
+	}
+
+	path := filepath.Join(t.TempDir(), "enroll.iris")
+	if err := os.WriteFile(path, append(bytes.Clone(code), mask...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := NewIrisSource(path).Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fe := NewDefaultIrisExtractor(2, 4)
+	key, helpers, err := fe.Gen(hex.EncodeToString(features))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Occluded bits are noise in the probe and must never be sampled
+	probe := bytes.Clone(code)
+	for i := range 32 {
+		probe[i] ^= 0xff
+	}
+	probe = RotateBits(probe, 3)
+
+	key2, err := fe.Rep(hex.EncodeToString(append(probe, mask...)), helpers)
+	if err != nil {
+		t.Fatal("Failed to reproduce key from rotated iris code")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	if _, err := NewDefaultIrisExtractor(2, 0).Rep(hex.EncodeToString(append(probe, mask...)), helpers); err == nil {
+		t.Error("Expected rotated iris code to fail without shifts")
+	}
+}
@@ -0,0 +1,168 @@
+package lib_test
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+// counterReader is a deterministic stream of SHA-256(seed || counter) blocks.
+type counterReader struct {
+	seed    string
+	counter uint64
+	buffer  []byte
+}
+
+func (r *counterReader) Read(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		if len(r.buffer) == 0 {
+			block := sha256.Sum256(binary.BigEndian.AppendUint64([]byte(r.seed), r.counter))
+			r.buffer = block[:]
+			r.counter++
+		}
+		c := copy(p[n:], r.buffer)
+		r.buffer = r.buffer[c:]
+		n += c
+	}
+	return len(p), nil
+}
+
+type katCase[T Number] struct {
+	name    string
+	fe      FuzzyExtractor[T]
+	value   string
+	mask    string
+	probe   string
+	key     string
+	helpers string // SHA-256 of the serialized helpers
+}
+
+func fuzzy32KATs() []katCase[uint32] {
+	return []katCase[uint32]{
+		{
+			name:    "default",
+			fe:      NewDefaultFuzzy32Extractor(4, 2),
+			value:   "00112233445566778899aabbccddeeff",
+			probe:   "00112223445566778899abbbccddeeff",
+			key:     "a0f67a4a5296ba42fefdf8236123ce14",
+			helpers: "92d55e0eb6bfeab950f22cfe4f300494015a76d3e60c1c4e42b37daabc52f391",
+		},
+		{
+			name:    "masked",
+			fe:      NewDefaultFuzzy32Extractor(4, 2),
+			value:   "00112233445566778899aabbccddeeff",
+			mask:    "ffffffffffffffff00000000ffffffff",
+			probe:   "00112233445566770000000000ddeeff",
+			key:     "2796f1ee7cd26f1a4627ddcc5fc2abb8",
+			helpers: "2e6f8cb47bcf5194d2c7dad4629dc9aba23f260815902f5f47708dd12baecd49",
+		},
+		{
+			name:    "kdf",
+			fe:      NewFuzzy32ExtractorWithKDF(8, 3, 0.01, 3, 8, KDFParams{Hash: sha512.New, Iterations: 3}),
+			value:   "0123456789abcdeffedcba98765432100123456789abcdeffedcba9876543210",
+			probe:   "0123456789abcdeffedcba98765432100123456789abcdeffedcba9876543211",
+			key:     "6e01b950c4ac9603723b44a5f351aaf16acba58b41e140d7f48deda9b1334a87",
+			helpers: "aa575145354fc4b6d0c7718e35385b422837647af3955c0f223ce20a1cb044b6",
+		},
+	}
+}
+
+// TestFuzzy32KAT pins the output of the 32 bit extractor for a fixed random
+// stream, so optimizations of Gen and Rep cannot change what they compute.
+// These vectors and those of fuzzyKATs were generated by the extractors as
+// they were before the scratch buffer rewrite, with crypto/rand swapped for
+// counterReader; the vectors of TestGenericKAT only exist since then.
+func TestFuzzy32KAT(t *testing.T) {
+	testKAT(t, fuzzy32KATs())
+}
+
+func fuzzyKATs() []katCase[byte] {
+	return []katCase[byte]{
+		{
+			name:    "default",
+			fe:      NewDefaultFuzzyExtractor(16, 4),
+			value:   "00112233445566778899aabbccddeeff",
+			probe:   "00112223445566778899abbbccddeeff",
+			key:     "a0f67a4a5296ba42fefdf8236123ce14",
+			helpers: "28a0c8c5422aa204064228d3c6a30c8adad4cd3d0f359967f7814c99a970d09a",
+		},
+		{
+			name:    "masked",
+			fe:      NewDefaultFuzzyExtractor(16, 4),
+			value:   "00112233445566778899aabbccddeeff",
+			mask:    "ffffffffffffffff0000000000ffffff",
+			probe:   "0011223344556677ffffffffffddeeff",
+			key:     "2796f1ee7cd26f1a4627ddcc5fc2abb8",
+			helpers: "324fe6e77cfeaf804d8c2ad58febc559e01dfde161a64c5ccac3f10d3a1cfdd7",
+		},
+	}
+}
+
+// TestFuzzyKAT pins the output of the byte extractor the same way.
+func TestFuzzyKAT(t *testing.T) {
+	testKAT(t, fuzzyKATs())
+}
+
+func testKAT[T Number](t *testing.T, cases []katCase[T]) {
+	for _, c := range cases {
+		fe := WithRandom(c.fe, &counterReader{seed: c.name})
+
+		var key Key
+		var helpers *Helpers[T]
+		var err error
+		if c.mask == "" {
+			key, helpers, err = fe.Gen(c.value)
+		} else {
+			key, helpers, err = fe.(MaskedFuzzyExtractor[T]).GenMasked(c.value, c.mask)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		b, err := helpers.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		digest := sha256.Sum256(b)
+
+		if string(key) != c.key {
+			t.Errorf("%s: key does not match", c.name)
+		}
+		if hex.EncodeToString(digest[:]) != c.helpers {
+			t.Errorf("%s: helpers do not match", c.name)
+		}
+
+		key2, err := fe.Rep(c.probe, helpers)
+		if err != nil || key2 != key {
+			t.Errorf("%s: failed to reproduce key", c.name)
+		}
+	}
+}
+
+// TestGenericKAT pins the widths that only the generic constructor offers.
+func TestGenericKAT(t *testing.T) {
+	testKAT(t, []katCase[uint16]{
+		{
+			name:    "uint16",
+			fe:      NewDefaultGenericFuzzyExtractor[uint16](8, 3),
+			value:   "00112233445566778899aabbccddeeff",
+			probe:   "00112223445566778899abbbccddeeff",
+			key:     "a9d7de443ab305c2be58f1061970c4e4",
+			helpers: "d9dfe4371907615e8bc52b975d852fd132ee56e283218b3a22727be375b75dd9",
+		},
+	})
+	testKAT(t, []katCase[uint64]{
+		{
+			name:    "uint64",
+			fe:      NewDefaultGenericFuzzyExtractor[uint64](2, 1),
+			value:   "00112233445566778899aabbccddeeff",
+			probe:   "00112233445566778899abbbccddeeff",
+			key:     "fa99eb6830175233b338e01040c69fac",
+			helpers: "acc01b892ab05e9b08a867b9d276dc6dc34c8f11f29097bfaebb2161d169a81c",
+		},
+	})
+}
@@ -0,0 +1,349 @@
+// Package merkle signs a whole directory tree with a single signature. Every
+// file is hashed into a leaf bound to its relative path, the leaves form an
+// RFC 6962 Merkle tree, and only the root is signed. Each file then gets an
+// inclusion proof carrying the signed root, so one file can be checked without
+// the rest of the tree.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// RootName is the signed root written into a signed directory.
+const RootName = "gofze-merkle.json"
+
+// ProofSuffix is appended to a file's path to name its inclusion proof.
+const ProofSuffix = ".proof"
+
+// Leaf is one file of the tree, named by its slash separated path relative to
+// the signed directory.
+type Leaf struct {
+	Path   string `json:"path"`
+	Digest []byte `json:"digest"`
+}
+
+// Tree is the Merkle tree over the leaves, in lexical path order.
+type Tree struct {
+	Leaves []Leaf
+	nodes  map[[2]int][]byte
+}
+
+// SignedRoot is the signed root hash of a tree of Size leaves.
+type SignedRoot struct {
+	Root      []byte               `json:"root"`
+	Size      int                  `json:"size"`
+	Signature *lib.SignatureBundle `json:"signature"`
+}
+
+// Proof shows that a file is a leaf of a signed tree.
+type Proof struct {
+	Path   string      `json:"path"`
+	Index  int         `json:"index"`
+	Hashes [][]byte    `json:"hashes"`
+	Root   *SignedRoot `json:"root"`
+}
+
+// leafHash binds the content digest to the path, with the RFC 6962 leaf prefix.
+func leafHash(leaf Leaf) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	binary.Write(h, binary.BigEndian, uint16(len(leaf.Path)))
+	h.Write([]byte(leaf.Path))
+	h.Write(leaf.Digest)
+	return h.Sum(nil)
+}
+
+// nodeHash joins two subtrees with the RFC 6962 node prefix.
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split is the largest power of two smaller than n.
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// New builds the tree over leaves, which must be sorted by path.
+func New(leaves []Leaf) (*Tree, error) {
+	if len(leaves) == 0 {
+		return nil, errors.New("gofze/lib/merkle/merkle.go: empty tree")
+	}
+	for i := 1; i < len(leaves); i++ {
+		if leaves[i-1].Path >= leaves[i].Path {
+			return nil, errors.New("gofze/lib/merkle/merkle.go: leaves are not sorted or not unique")
+		}
+	}
+
+	return &Tree{Leaves: leaves, nodes: map[[2]int][]byte{}}, nil
+}
+
+// Build hashes every regular file under dir, leaving out proofs and roots.
+func Build(dir string) (*Tree, error) {
+	leaves := []Leaf{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if !d.Type().IsRegular() || strings.HasSuffix(name, ProofSuffix) || name == RootName {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		digest, err := lib.HashReader(lib.DigestSHA256, f)
+		if err != nil {
+			return err
+		}
+		leaves = append(leaves, Leaf{Path: filepath.ToSlash(rel), Digest: digest})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// WalkDir visits directories in lexical order, which is not path order
+	// once separators are compared with other characters
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Path < leaves[j].Path })
+	return New(leaves)
+}
+
+// hash is the root of the subtree over leaves [start, end), memoised since
+// every proof reuses the same subtrees.
+func (t *Tree) hash(start, end int) []byte {
+	if h, ok := t.nodes[[2]int{start, end}]; ok {
+		return h
+	}
+
+	var h []byte
+	if end-start == 1 {
+		h = leafHash(t.Leaves[start])
+	} else {
+		k := start + split(end-start)
+		h = nodeHash(t.hash(start, k), t.hash(k, end))
+	}
+	t.nodes[[2]int{start, end}] = h
+	return h
+}
+
+// Root returns the root hash of the tree.
+func (t *Tree) Root() []byte {
+	return t.hash(0, len(t.Leaves))
+}
+
+// path returns the audit path of leaf m in the subtree [start, end).
+func (t *Tree) path(m, start, end int) [][]byte {
+	if end-start == 1 {
+		return [][]byte{}
+	}
+
+	k := start + split(end-start)
+	if m < k {
+		return append(t.path(m, start, k), t.hash(k, end))
+	}
+	return append(t.path(m, k, end), t.hash(start, k))
+}
+
+// Sign signs the root of the tree.
+func Sign(signer lib.Signer, t *Tree) (*SignedRoot, error) {
+	root := t.Root()
+	sb, err := lib.SignBundle(signer, message(root, len(t.Leaves)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedRoot{Root: root, Size: len(t.Leaves), Signature: sb}, nil
+}
+
+// message is what the signer signs for a root over size leaves.
+func message(root []byte, size int) []byte {
+	b := binary.BigEndian.AppendUint64([]byte("gofze/merkle/v1:"), uint64(size))
+	return append(b, root...)
+}
+
+// Verify checks the signature over the root.
+func (sr *SignedRoot) Verify() error {
+	if sr.Signature == nil || sr.Size <= 0 {
+		return errors.New("gofze/lib/merkle/merkle.go: incomplete signed root")
+	}
+	return sr.Signature.Verify(message(sr.Root, sr.Size))
+}
+
+// VerifyTree checks that the signed root is the root of t, as rebuilt by the
+// verifier from the whole directory.
+func (sr *SignedRoot) VerifyTree(t *Tree) error {
+	if err := sr.Verify(); err != nil {
+		return err
+	}
+	if sr.Size != len(t.Leaves) || !bytes.Equal(sr.Root, t.Root()) {
+		return errors.New("gofze/lib/merkle/merkle.go: tree does not match the signed root")
+	}
+	return nil
+}
+
+// Proofs returns the inclusion proof of every leaf under the signed root.
+func (t *Tree) Proofs(sr *SignedRoot) []*Proof {
+	proofs := make([]*Proof, len(t.Leaves))
+	for i, leaf := range t.Leaves {
+		proofs[i] = &Proof{
+			Path:   leaf.Path,
+			Index:  i,
+			Hashes: t.path(i, 0, len(t.Leaves)),
+			Root:   sr,
+		}
+	}
+	return proofs
+}
+
+// VerifyDigest checks that a file with the given SHA-256 digest is leaf
+// p.Index of the signed tree, following RFC 9162 section 2.1.3.2.
+func (p *Proof) VerifyDigest(digest []byte) error {
+	if p.Root == nil {
+		return errors.New("gofze/lib/merkle/merkle.go: proof has no signed root")
+	}
+	if err := p.Root.Verify(); err != nil {
+		return err
+	}
+	if p.Index < 0 || p.Index >= p.Root.Size {
+		return errors.New("gofze/lib/merkle/merkle.go: leaf index out of range")
+	}
+
+	fn, sn := p.Index, p.Root.Size-1
+	r := leafHash(Leaf{Path: p.Path, Digest: digest})
+	for _, h := range p.Hashes {
+		if sn == 0 {
+			return errors.New("gofze/lib/merkle/merkle.go: proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(h, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, h)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(r, p.Root.Root) {
+		return errors.New("gofze/lib/merkle/merkle.go: file is not in the signed tree")
+	}
+	return nil
+}
+
+// Verify checks that the content read from r is the file of the proof.
+func (p *Proof) Verify(r io.Reader) error {
+	digest, err := lib.HashReader(lib.DigestSHA256, r)
+	if err != nil {
+		return err
+	}
+	return p.VerifyDigest(digest)
+}
+
+// VerifyFile checks the file at path against the proof, which must name it by
+// its path relative to root, the signed directory, so the proof of one file
+// cannot vouch for a copy of it elsewhere in the tree.
+func (p *Proof) VerifyFile(root, path string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absRoot, abs)
+	if err != nil || filepath.ToSlash(rel) != p.Path {
+		return errors.New("gofze/lib/merkle/merkle.go: proof is for " + p.Path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return p.Verify(f)
+}
+
+// save writes v as JSON.
+func save(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// SaveRoot writes the signed root as JSON.
+func SaveRoot(path string, sr *SignedRoot) error {
+	return save(path, sr)
+}
+
+// LoadRoot reads a signed root written by SaveRoot.
+func LoadRoot(path string) (*SignedRoot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &SignedRoot{}
+	if err := json.Unmarshal(b, sr); err != nil {
+		return nil, err
+	}
+	if err := sr.Verify(); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+// SaveProof writes the proof as JSON.
+func SaveProof(path string, p *Proof) error {
+	return save(path, p)
+}
+
+// LoadProof reads a proof written by SaveProof.
+func LoadProof(path string) (*Proof, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Proof{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, err
+	}
+	if p.Root == nil || p.Path == "" {
+		return nil, errors.New("gofze/lib/merkle/merkle.go: incomplete proof")
+	}
+	return p, nil
+}
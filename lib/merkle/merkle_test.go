@@ -0,0 +1,146 @@
+package merkle_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/merkle"
+)
+
+func TestProofs(t *testing.T) {
+	s, err := lib.NewSigner(lib.AlgEd25519, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for size := 1; size <= 17; size++ {
+		leaves := make([]Leaf, size)
+		for i := range leaves {
+			digest := sha256.Sum256([]byte{byte(i)})
+			leaves[i] = Leaf{Path: fmt.Sprintf("file%02d", i), Digest: digest[:]}
+		}
+
+		tree, err := New(leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr, err := Sign(s, tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, p := range tree.Proofs(sr) {
+			if err := p.VerifyDigest(leaves[i].Digest); err != nil {
+				t.Errorf("size %d, leaf %d: %v", size, i, err)
+			}
+
+			// Another file, path or position is not in the tree
+			if err := p.VerifyDigest(leaves[(i+1)%size].Digest); err == nil && size > 1 {
+				t.Errorf("size %d, leaf %d: another digest verified", size, i)
+			}
+			moved := *p
+			moved.Path = "renamed"
+			if err := moved.VerifyDigest(leaves[i].Digest); err == nil {
+				t.Errorf("size %d, leaf %d: renamed file verified", size, i)
+			}
+			if size > 1 {
+				moved = *p
+				moved.Index = (i + 1) % size
+				if err := moved.VerifyDigest(leaves[i].Digest); err == nil {
+					t.Errorf("size %d, leaf %d: wrong index verified", size, i)
+				}
+			}
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a"), 0o755)
+	for _, name := range []string{"a/b", "a-b", "c"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600)
+	}
+
+	tree, err := Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Leaves) != 3 || tree.Leaves[0].Path != "a-b" || tree.Leaves[1].Path != "a/b" {
+		t.Fatalf("Unexpected leaves: %+v", tree.Leaves)
+	}
+
+	s, _ := lib.NewSigner(lib.AlgECDSAP256, bytes.Repeat([]byte{7}, 32))
+	sr, err := Sign(s, tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Proofs and roots written into the directory are not part of the tree
+	root := filepath.Join(dir, RootName)
+	if err := SaveRoot(root, sr); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range tree.Proofs(sr) {
+		if err := SaveProof(filepath.Join(dir, filepath.FromSlash(p.Path)+ProofSuffix), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rebuilt, err := Build(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRoot(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.VerifyTree(rebuilt); err != nil {
+		t.Error(err)
+	}
+
+	// A single file checks against its proof alone
+	p, err := LoadProof(filepath.Join(dir, "a", "b"+ProofSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify(bytes.NewReader([]byte("a/b"))); err != nil {
+		t.Error(err)
+	}
+	if err := p.Verify(bytes.NewReader([]byte("tampered"))); err == nil {
+		t.Error("Tampered file verified")
+	}
+
+	// The proof only holds for the file it names, relative to the signed root
+	if err := p.VerifyFile(dir, filepath.Join(dir, "a", "b")); err != nil {
+		t.Error(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "x", "a"), 0o755)
+	os.WriteFile(filepath.Join(dir, "x", "b"), []byte("a/b"), 0o600)
+	os.WriteFile(filepath.Join(dir, "x", "a", "b"), []byte("a/b"), 0o600)
+	if err := p.VerifyFile(dir, filepath.Join(dir, "x", "b")); err == nil {
+		t.Error("Verified a copy of the file at another path")
+	}
+	if err := p.VerifyFile(dir, filepath.Join(dir, "x", "a", "b")); err == nil {
+		t.Error("Verified a copy of the file under another directory")
+	}
+	if err := p.VerifyFile(filepath.Join(dir, "a"), filepath.Join(dir, "a", "b")); err == nil {
+		t.Error("Verified the file against another root")
+	}
+	os.RemoveAll(filepath.Join(dir, "x"))
+
+	// A forged root is rejected even with a matching tree
+	p.Root.Root[0] ^= 1
+	if err := p.Verify(bytes.NewReader([]byte("a/b"))); err == nil {
+		t.Error("Forged root verified")
+	}
+
+	os.WriteFile(filepath.Join(dir, "c"), []byte("tampered"), 0o600)
+	if rebuilt, _ = Build(dir); loaded.VerifyTree(rebuilt) == nil {
+		t.Error("Tampered tree verified")
+	}
+}
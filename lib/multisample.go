@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// DefaultAgreement is the fraction of enrollment samples that must agree on a
+// bit for it to be considered reliable.
+const DefaultAgreement = 0.75
+
+// ReliableBits combines equally long samples into their bitwise majority and a
+// mask of the bits on which at least `agreement` of the samples agree with it.
+func ReliableBits(samples [][]byte, agreement float64) ([]byte, []byte, error) {
+	if len(samples) == 0 {
+		return nil, nil, errors.New("gofze/lib/multisample.go: no samples")
+	}
+
+	if agreement <= 0.5 || agreement > 1 {
+		return nil, nil, errors.New("gofze/lib/multisample.go: agreement must be in (0.5, 1]")
+	}
+
+	length := len(samples[0])
+	for _, sample := range samples {
+		if len(sample) != length {
+			return nil, nil, errors.New("gofze/lib/multisample.go: samples differ in length")
+		}
+	}
+
+	template := make([]byte, length)
+	mask := make([]byte, length)
+	for i := range length * 8 {
+		ones := 0
+		for _, sample := range samples {
+			ones += int(sample[i/8] >> (7 - i%8) & 1)
+		}
+
+		majority := max(ones, len(samples)-ones)
+		if ones > len(samples)-ones {
+			template[i/8] |= 1 << (7 - i%8)
+		}
+		if float64(majority) >= agreement*float64(len(samples)) {
+			mask[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return template, mask, nil
+}
+
+// GenMultiSample enrolls several captures of the same trait at once. Only the
+// bits that stay stable across the captures are sampled by the lockers, which
+// keeps bits that flip between captures from causing false rejects. The
+// reliable positions are recorded in the helpers for Rep.
+func GenMultiSample[T Number](fe MaskedFuzzyExtractor[T], sources []FeatureSource, agreement float64) (Key, *Helpers[T], error) {
+	if len(sources) < 2 {
+		return "", nil, errors.New("gofze/lib/multisample.go: at least two samples are required")
+	}
+
+	samples := make([][]byte, len(sources))
+	for i, source := range sources {
+		features, err := source.Features()
+		if err != nil {
+			return "", nil, err
+		}
+		samples[i] = features
+	}
+
+	template, mask, err := ReliableBits(samples, agreement)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fe.GenMasked(hex.EncodeToString(template), hex.EncodeToString(mask))
+}
@@ -0,0 +1,69 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestReliableBits(t *testing.T) {
+	samples := [][]byte{
+		{0b11110000, 0xff},
+		{0b11110001, 0xff},
+		{0b11110010, 0xff},
+		{0b11110000, 0x00},
+	}
+
+	template, mask, err := ReliableBits(samples, 0.75)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(template, []byte{0b11110000, 0xff}) {
+		t.Errorf("Template does not match: %08b", template)
+	}
+
+	if !bytes.Equal(mask, []byte{0xff, 0xff}) {
+		t.Errorf("Mask does not match: %08b", mask)
+	}
+
+	_, mask, _ = ReliableBits(samples, 1)
+	if !bytes.Equal(mask, []byte{0b11111100, 0x00}) {
+		t.Errorf("Strict mask does not match: %08b", mask)
+	}
+}
+
+func TestGenMultiSample(t *testing.T) {
+	captures := []string{
+		"00112233445566778899aabbccddeeff",
+		"00112233445566778899aabbccddee00",
+		"0011223344556677ff99aabbccddee0f",
+	}
+
+	sources := make([]FeatureSource, len(captures))
+	for i, capture := range captures {
+		sources[i] = NewHexSource(strings.NewReader(capture), 16)
+	}
+
+	fe := NewDefaultFuzzy32Extractor(4, 1)
+	key, helpers, err := GenMultiSample(fe, sources, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unstable bits are never sampled, so a probe may disagree on all of them
+	key2, err := fe.Rep("0011223344556677ff99aabbccddeef0", helpers)
+	if err != nil {
+		t.Fatal("Failed to reproduce key")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	if _, _, err := GenMultiSample(fe, sources[:1], 1); err == nil {
+		t.Error("Expected a single sample to be rejected")
+	}
+}
@@ -0,0 +1,275 @@
+// Package pdf embeds detached CMS signatures in PDF documents, so a signed
+// document such as tc/test.pdf is self-contained. Signing appends an
+// incremental update holding an invisible signature field, a signature
+// dictionary whose ByteRange covers the whole file except its Contents, and
+// the catalog with an AcroForm pointing at the field. The original bytes are
+// left untouched.
+//
+// The update ends in a cross-reference table, or in a cross-reference stream
+// when the document does, as readers of such documents may not accept a table
+// after a stream. Only documents whose catalog is a plain object and that have
+// no AcroForm yet are supported; catalogs inside object streams are not parsed.
+package pdf
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/cms"
+)
+
+// ContentsSize is the space reserved for the DER signature in bytes.
+const ContentsSize = 8192
+
+// byteRangePlaceholder has room for the four offsets written after layout.
+const byteRangePlaceholder = "/ByteRange [0 0000000000 0000000000 0000000000]"
+
+var (
+	startXRef = regexp.MustCompile(`startxref\s+(\d+)`)
+	rootRef   = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	sizeEntry = regexp.MustCompile(`/Size\s+(\d+)`)
+	infoRef   = regexp.MustCompile(`/Info\s+\d+\s+\d+\s+R`)
+	idEntry   = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	byteRange = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+)
+
+// dictionary returns the dictionary starting at the first "<<" at or after
+// offset, skipping strings so their brackets do not count.
+func dictionary(b []byte, offset int) ([]byte, error) {
+	start := bytes.Index(b[offset:], []byte("<<"))
+	if start < 0 {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: dictionary not found")
+	}
+	start += offset
+
+	depth := 0
+	for i := start; i < len(b); i++ {
+		switch {
+		case bytes.HasPrefix(b[i:], []byte("<<")):
+			depth++
+			i++
+		case bytes.HasPrefix(b[i:], []byte(">>")):
+			depth--
+			i++
+			if depth == 0 {
+				return b[start : i+1], nil
+			}
+		case b[i] == '<':
+			// Hex string
+			end := bytes.IndexByte(b[i:], '>')
+			if end < 0 {
+				return nil, errors.New("gofze/lib/pdf/pdf.go: unterminated string")
+			}
+			i += end
+		case b[i] == '(':
+			// Literal string with balanced parentheses and escapes
+			nested := 0
+			for ; i < len(b); i++ {
+				if b[i] == '\\' {
+					i++
+				} else if b[i] == '(' {
+					nested++
+				} else if b[i] == ')' {
+					if nested--; nested == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+	return nil, errors.New("gofze/lib/pdf/pdf.go: unterminated dictionary")
+}
+
+// trailer returns the offset of the last cross-reference section and its
+// trailer dictionary, or the dictionary of a cross-reference stream.
+func trailer(b []byte) (int, []byte, error) {
+	matches := startXRef.FindAllSubmatch(b, -1)
+	if len(matches) == 0 {
+		return 0, nil, errors.New("gofze/lib/pdf/pdf.go: startxref not found")
+	}
+
+	offset, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || offset >= len(b) {
+		return 0, nil, errors.New("gofze/lib/pdf/pdf.go: invalid startxref")
+	}
+
+	from := offset
+	if bytes.HasPrefix(b[offset:], []byte("xref")) {
+		t := bytes.Index(b[offset:], []byte("trailer"))
+		if t < 0 {
+			return 0, nil, errors.New("gofze/lib/pdf/pdf.go: trailer not found")
+		}
+		from += t
+	}
+
+	dict, err := dictionary(b, from)
+	return offset, dict, err
+}
+
+// object returns the dictionary of the last definition of an object, which is
+// the one in effect after incremental updates.
+func object(b []byte, number, generation string) ([]byte, error) {
+	definition := regexp.MustCompile(`(?:^|[\s>])` + number + `\s+` + generation + `\s+obj\b`)
+	matches := definition.FindAllIndex(b, -1)
+	if len(matches) == 0 {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: object " + number + " not found")
+	}
+	return dictionary(b, matches[len(matches)-1][1])
+}
+
+// Sign returns the document with an embedded signature by signer, which must
+// be one of the signers supported by package cms.
+func Sign(document []byte, signer lib.Signer) ([]byte, error) {
+	prev, trailerDict, err := trailer(document)
+	if err != nil {
+		return nil, err
+	}
+
+	root := rootRef.FindSubmatch(trailerDict)
+	size := sizeEntry.FindSubmatch(trailerDict)
+	if root == nil || size == nil {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: trailer has no Root or Size")
+	}
+
+	catalog, err := object(document, string(root[1]), string(root[2]))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(catalog, []byte("/AcroForm")) {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: documents with forms are not supported")
+	}
+
+	n, _ := strconv.Atoi(string(size[1]))
+	sigNumber, fieldNumber := n, n+1
+
+	out := bytes.NewBuffer(append([]byte{}, document...))
+	if !bytes.HasSuffix(document, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+
+	offsets := map[int]int{}
+
+	// Signature dictionary with placeholders
+	offsets[sigNumber] = out.Len()
+	fmt.Fprintf(out, "%d 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached ", sigNumber)
+	rangeOffset := out.Len()
+	out.WriteString(byteRangePlaceholder)
+	out.WriteString(" /Contents ")
+	contentsStart := out.Len()
+	out.WriteString("<" + string(bytes.Repeat([]byte("0"), 2*ContentsSize)) + ">")
+	contentsEnd := out.Len()
+	fmt.Fprintf(out, " /M (D:%s) /Name (gofze) >>\nendobj\n", time.Now().UTC().Format("20060102150405Z"))
+
+	// Invisible signature field
+	offsets[fieldNumber] = out.Len()
+	fmt.Fprintf(out, "%d 0 obj\n<< /FT /Sig /Type /Annot /Subtype /Widget /F 132 /Rect [0 0 0 0] /T (gofze) /V %d 0 R >>\nendobj\n", fieldNumber, sigNumber)
+
+	// Catalog with the AcroForm
+	catalogNumber, _ := strconv.Atoi(string(root[1]))
+	offsets[catalogNumber] = out.Len()
+	fmt.Fprintf(out, "%s %s obj\n%s /AcroForm << /Fields [%d 0 R] /SigFlags 3 >> >>\nendobj\n",
+		root[1], root[2], catalog[:len(catalog)-2], fieldNumber)
+
+	// Trailer entries carried over from the previous section
+	carried := []byte{}
+	if info := infoRef.Find(trailerDict); info != nil {
+		carried = append(append(carried, info...), ' ')
+	}
+	if id := idEntry.Find(trailerDict); id != nil {
+		carried = append(append(carried, id...), ' ')
+	}
+
+	// Cross-reference section, one subsection per object
+	xref := out.Len()
+	catalogGeneration, _ := strconv.Atoi(string(root[2]))
+	generations := map[int]int{catalogNumber: catalogGeneration}
+	if bytes.HasPrefix(document[prev:], []byte("xref")) {
+		out.WriteString("xref\n")
+		for _, number := range []int{catalogNumber, sigNumber, fieldNumber} {
+			fmt.Fprintf(out, "%d 1\n%010d %05d n\r\n", number, offsets[number], generations[number])
+		}
+		fmt.Fprintf(out, "trailer\n<< /Size %d /Root %s %s R %s/Prev %d >>\n", fieldNumber+1, root[1], root[2], carried, prev)
+	} else {
+		// The stream lists itself too, with entries of type, offset and generation
+		if xref > 1<<32-1 {
+			return nil, errors.New("gofze/lib/pdf/pdf.go: document too large for the cross-reference stream")
+		}
+		xrefNumber := fieldNumber + 1
+		offsets[xrefNumber] = xref
+		index, entries := []byte{}, []byte{}
+		for _, number := range []int{catalogNumber, sigNumber, fieldNumber, xrefNumber} {
+			index = fmt.Appendf(index, "%d 1 ", number)
+			entries = append(entries, 1)
+			entries = binary.BigEndian.AppendUint32(entries, uint32(offsets[number]))
+			entries = binary.BigEndian.AppendUint16(entries, uint16(generations[number]))
+		}
+		fmt.Fprintf(out, "%d 0 obj\n<< /Type /XRef /Size %d /Root %s %s R %s/Prev %d /W [1 4 2] /Index [%s] /Length %d >>\nstream\n",
+			xrefNumber, xrefNumber+1, root[1], root[2], carried, prev, index[:len(index)-1], len(entries))
+		out.Write(entries)
+		out.WriteString("\nendstream\nendobj\n")
+	}
+	fmt.Fprintf(out, "startxref\n%d\n%%%%EOF\n", xref)
+
+	// Fill in the byte range, then sign everything but the contents
+	signed := out.Bytes()
+	ranges := fmt.Sprintf("/ByteRange [0 %010d %010d %010d]", contentsStart, contentsEnd, len(signed)-contentsEnd)
+	copy(signed[rangeOffset:], ranges)
+
+	content := append(append([]byte{}, signed[:contentsStart]...), signed[contentsEnd:]...)
+	der, err := cms.Sign(signer, content)
+	if err != nil {
+		return nil, err
+	}
+	if len(der) > ContentsSize {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: signature does not fit the reserved contents")
+	}
+	hex.Encode(signed[contentsStart+1:], der)
+	return signed, nil
+}
+
+// Verify checks the last signature of the document and returns the
+// certificate of its signer. The signature must cover the whole file, so
+// changes appended after signing are rejected.
+func Verify(document []byte) (*x509.Certificate, error) {
+	matches := byteRange.FindAllSubmatch(document, -1)
+	if len(matches) == 0 {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: document is not signed")
+	}
+
+	r := [4]int{}
+	for i := range r {
+		r[i], _ = strconv.Atoi(string(matches[len(matches)-1][i+1]))
+	}
+
+	if r[0] != 0 || r[1] >= r[2] || r[2]+r[3] != len(document) {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: signature does not cover the whole document")
+	}
+
+	contents := document[r[1]:r[2]]
+	if len(contents) < 2 || contents[0] != '<' || contents[len(contents)-1] != '>' {
+		return nil, errors.New("gofze/lib/pdf/pdf.go: malformed signature contents")
+	}
+
+	der := make([]byte, (len(contents)-2)/2)
+	if _, err := hex.Decode(der, contents[1:len(contents)-1]); err != nil {
+		return nil, err
+	}
+
+	// Drop the zero padding after the DER signature
+	raw := asn1.RawValue{}
+	if _, err := asn1.Unmarshal(der, &raw); err != nil {
+		return nil, err
+	}
+
+	content := append(append([]byte{}, document[:r[1]]...), document[r[2]:]...)
+	return cms.Verify(raw.FullBytes, content)
+}
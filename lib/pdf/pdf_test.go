@@ -0,0 +1,142 @@
+package pdf_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/pdf"
+)
+
+func TestSignVerify(t *testing.T) {
+	document, err := os.ReadFile("../../tc/test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []string{lib.AlgEd25519, lib.AlgECDSAP256} {
+		s, err := lib.NewSigner(alg, bytes.Repeat([]byte{7}, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signed, err := Sign(document, s)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		if !bytes.HasPrefix(signed, document) {
+			t.Errorf("%s: expected an incremental update", alg)
+		}
+		checkXRef(t, signed[len(document):], len(document))
+
+		if _, err := Verify(signed); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+
+		tampered := append([]byte{}, signed...)
+		tampered[100] ^= 1
+		if _, err := Verify(tampered); err == nil {
+			t.Errorf("%s: expected a modified document to be rejected", alg)
+		}
+
+		if _, err := Verify(append(signed, "% appended\n"...)); err == nil {
+			t.Errorf("%s: expected an appended update to be rejected", alg)
+		}
+	}
+
+	if _, err := Verify(document); err == nil {
+		t.Error("Expected an unsigned document to be rejected")
+	}
+}
+
+// checkXRef requires every entry of the appended cross-reference section to
+// point at the definition of its object.
+func checkXRef(t *testing.T, update []byte, base int) {
+	entry := regexp.MustCompile(`(\d+) 1\n(\d{10}) (\d{5}) n\r\n`)
+	entries := entry.FindAllSubmatch(update, -1)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 cross-reference entries, got %d", len(entries))
+	}
+
+	for _, e := range entries {
+		offset, _ := strconv.Atoi(string(e[2]))
+		generation, _ := strconv.Atoi(string(e[3]))
+		header := fmt.Sprintf("%s %d obj", e[1], generation)
+		if !bytes.HasPrefix(update[offset-base:], []byte(header)) {
+			t.Errorf("Entry of object %s does not point at its definition", e[1])
+		}
+	}
+}
+
+// xrefStreamPDF is a minimal PDF 1.5 document whose cross-reference section is
+// an uncompressed stream, as written by many producers.
+func xrefStreamPDF() []byte {
+	b := []byte("%PDF-1.5\n")
+	offsets := []int{}
+	for _, object := range []string{
+		"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n",
+		"2 0 obj\n<< /Type /Pages /Kids [] /Count 0 >>\nendobj\n",
+	} {
+		offsets = append(offsets, len(b))
+		b = append(b, object...)
+	}
+	xref := len(b)
+	offsets = append(offsets, xref)
+
+	entries := []byte{0, 0, 0, 0, 0, 0xff, 0xff}
+	for _, offset := range offsets {
+		entries = append(entries, 1)
+		entries = binary.BigEndian.AppendUint32(entries, uint32(offset))
+		entries = binary.BigEndian.AppendUint16(entries, 0)
+	}
+	b = fmt.Appendf(b, "3 0 obj\n<< /Type /XRef /Size 4 /Root 1 0 R /W [1 4 2] /Length %d >>\nstream\n", len(entries))
+	b = append(b, entries...)
+	return fmt.Appendf(b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+}
+
+func TestSignXRefStream(t *testing.T) {
+	document := xrefStreamPDF()
+	s, _ := lib.NewSigner(lib.AlgECDSAP256, bytes.Repeat([]byte{7}, 32))
+	signed, err := Sign(document, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(signed); err != nil {
+		t.Error(err)
+	}
+
+	update := signed[len(document):]
+	if bytes.Contains(update, []byte("\nxref\n")) {
+		t.Fatal("Expected a cross-reference stream after a stream, got a table")
+	}
+
+	// Every entry of the stream points at the definition of its object
+	header := regexp.MustCompile(`/Prev (\d+) /W \[1 4 2\] /Index \[([\d ]+)\] /Length (\d+) >>\nstream\n`)
+	m := header.FindSubmatchIndex(update)
+	if m == nil {
+		t.Fatalf("Cross-reference stream not found in\n%s", update)
+	}
+	if prev, _ := strconv.Atoi(string(update[m[2]:m[3]])); prev != bytes.LastIndex(document, []byte("3 0 obj")) {
+		t.Errorf("Prev %d does not point at the previous stream", prev)
+	}
+	index := bytes.Fields(update[m[4]:m[5]])
+	length, _ := strconv.Atoi(string(update[m[6]:m[7]]))
+	data := update[m[1] : m[1]+length]
+	if len(index) != 8 || len(data) != 4*7 {
+		t.Fatalf("Expected 4 entries, got index %s", index)
+	}
+	for i := range 4 {
+		entry := data[7*i:]
+		offset := int(binary.BigEndian.Uint32(entry[1:5]))
+		obj := fmt.Sprintf("%s %d obj", index[2*i], binary.BigEndian.Uint16(entry[5:7]))
+		if entry[0] != 1 || !bytes.HasPrefix(signed[offset:], []byte(obj)) {
+			t.Errorf("Entry of object %s does not point at its definition", index[2*i])
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package rest serves enrollment, signing and verification as JSON over HTTP,
+// so applications in other languages need not shell out to the CLI. Requests
+// are multipart forms carrying captures, documents and records as files:
+//
+//	POST /v1/enroll  capture, and fields subject, source, minutiae, length,
+//	                 aligned, hammingError, robust, keyContext, algorithm,
+//	                 password or recipient (hex)
+//	                 -> the enrollment record
+//	POST /v1/sign    capture, document, and an enrollment file or a subject
+//	                 field, with fields password or identity (hex), algorithm,
+//	                 digest and contentType
+//	                 -> the signature bundle
+//	POST /v1/verify  document, signature, and field publicKey (hex)
+//	                 -> {"valid": true, ...}
+//	GET  /healthz    -> {"status": "ok"}
+//
+// Failures are answered as {"error": {"code": ..., "message": ...}} with the
+// code of the service.Error kind.
+package rest
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/service"
+)
+
+// DefaultMaxRequest bounds the size of a request body.
+const DefaultMaxRequest = 32 << 20
+
+// maxMemory is how much of a form is held in memory, the rest being spooled
+// to temporary files.
+const maxMemory = 8 << 20
+
+// Codes of errors not raised by the service.
+const (
+	codeTooLarge         = "request_too_large"
+	codeMethodNotAllowed = "method_not_allowed"
+)
+
+var statuses = map[string]int{
+	service.KindInvalid:      http.StatusBadRequest,
+	service.KindNotFound:     http.StatusNotFound,
+	service.KindNoMatch:      http.StatusUnauthorized,
+	service.KindBadSignature: http.StatusUnprocessableEntity,
+	service.KindRevoked:      http.StatusForbidden,
+	service.KindInternal:     http.StatusInternalServerError,
+	codeTooLarge:             http.StatusRequestEntityTooLarge,
+	codeMethodNotAllowed:     http.StatusMethodNotAllowed,
+}
+
+type handler struct {
+	svc        *service.Service
+	maxRequest int64
+	mux        *http.ServeMux
+}
+
+// NewHandler serves svc over HTTP, refusing request bodies larger than
+// maxRequest bytes, or DefaultMaxRequest when it is not positive.
+func NewHandler(svc *service.Service, maxRequest int64) http.Handler {
+	if maxRequest <= 0 {
+		maxRequest = DefaultMaxRequest
+	}
+
+	h := &handler{svc: svc, maxRequest: maxRequest, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/v1/enroll", h.post(h.enroll))
+	h.mux.HandleFunc("/v1/sign", h.post(h.sign))
+	h.mux.HandleFunc("/v1/verify", h.post(h.verify))
+	h.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// post admits POSTed multipart forms within the size limit.
+func (h *handler) post(next func(*http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			fail(w, codeMethodNotAllowed, errors.New("expected a POST"))
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxRequest)
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				fail(w, codeTooLarge, err)
+			} else {
+				fail(w, service.KindInvalid, err)
+			}
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		body, err := next(r)
+		if err != nil {
+			code := service.KindOf(err)
+			if code == service.KindInternal {
+				log.Printf("Error in %s: %v", r.URL.Path, err)
+			}
+			fail(w, code, err)
+			return
+		}
+		reply(w, http.StatusOK, body)
+	}
+}
+
+// reply writes a JSON body.
+func reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail writes a JSON error, leaving internal errors undescribed.
+func fail(w http.ResponseWriter, code string, err error) {
+	message := err.Error()
+	if code == service.KindInternal {
+		message = "internal error"
+	}
+	reply(w, statuses[code], map[string]any{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+// invalid marks a malformed request.
+func invalid(err error) error {
+	return &service.Error{Kind: service.KindInvalid, Err: err}
+}
+
+// file opens the form file called name, or returns nil when there is none.
+func file(r *http.Request, name string) (multipart.File, error) {
+	f, _, err := r.FormFile(name)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return f, nil
+}
+
+// requireFile opens the form file called name, which must be present.
+func requireFile(r *http.Request, name string) (multipart.File, *multipart.FileHeader, error) {
+	f, header, err := r.FormFile(name)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil, invalid(errors.New("a " + name + " is required"))
+	}
+	if err != nil {
+		return nil, nil, invalid(err)
+	}
+	return f, header, nil
+}
+
+// readFile reads the form file called name, or returns nil when there is none.
+func readFile(r *http.Request, name string) ([]byte, error) {
+	f, err := file(r, name)
+	if f == nil || err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// intField parses an optional integer field.
+func intField(r *http.Request, name string) (int, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, invalid(errors.New("invalid " + name))
+	}
+	return n, nil
+}
+
+// boolField parses an optional boolean field.
+func boolField(r *http.Request, name string) (bool, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, invalid(errors.New("invalid " + name))
+	}
+	return b, nil
+}
+
+// hexField decodes an optional hex field.
+func hexField(r *http.Request, name string) ([]byte, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(v)
+	if err != nil {
+		return nil, invalid(errors.New("invalid " + name))
+	}
+	return b, nil
+}
+
+func (h *handler) enroll(r *http.Request) (any, error) {
+	req := service.EnrollRequest{
+		Subject:    r.FormValue("subject"),
+		Source:     r.FormValue("source"),
+		KeyContext: r.FormValue("keyContext"),
+		Algorithm:  r.FormValue("algorithm"),
+		Password:   []byte(r.FormValue("password")),
+	}
+
+	var err error
+	if req.Minutiae, err = intField(r, "minutiae"); err != nil {
+		return nil, err
+	}
+	if req.Length, err = intField(r, "length"); err != nil {
+		return nil, err
+	}
+	if req.HammingError, err = intField(r, "hammingError"); err != nil {
+		return nil, err
+	}
+	if req.Aligned, err = boolField(r, "aligned"); err != nil {
+		return nil, err
+	}
+	if req.Robust, err = boolField(r, "robust"); err != nil {
+		return nil, err
+	}
+	if req.Recipient, err = hexField(r, "recipient"); err != nil {
+		return nil, err
+	}
+	if req.Capture, err = readFile(r, "capture"); err != nil {
+		return nil, err
+	}
+
+	return h.svc.Enroll(req)
+}
+
+func (h *handler) sign(r *http.Request) (any, error) {
+	req := service.SignRequest{
+		ReproduceRequest: service.ReproduceRequest{
+			Subject:    r.FormValue("subject"),
+			Algorithm:  r.FormValue("algorithm"),
+			Credential: lib.Credential{Password: []byte(r.FormValue("password"))},
+		},
+		Digest:      r.FormValue("digest"),
+		ContentType: r.FormValue("contentType"),
+	}
+
+	var err error
+	if req.Credential.Identity, err = hexField(r, "identity"); err != nil {
+		return nil, err
+	}
+	if req.Capture, err = readFile(r, "capture"); err != nil {
+		return nil, err
+	}
+
+	record, err := readFile(r, "enrollment")
+	if err != nil {
+		return nil, err
+	}
+	if record != nil {
+		if req.Enrollment, err = lib.ParseEnrollment(record); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	document, header, err := requireFile(r, "document")
+	if err != nil {
+		return nil, err
+	}
+	defer document.Close()
+	req.Document, req.Filename = document, header.Filename
+
+	return h.svc.Sign(req)
+}
+
+// verified is the answer to a valid signature.
+type verified struct {
+	Valid bool `json:"valid"`
+	*service.VerifyResult
+}
+
+func (h *handler) verify(r *http.Request) (any, error) {
+	req := service.VerifyRequest{}
+
+	var err error
+	if req.PublicKey, err = hexField(r, "publicKey"); err != nil {
+		return nil, err
+	}
+
+	signature, err := readFile(r, "signature")
+	if err != nil {
+		return nil, err
+	}
+	if signature != nil {
+		req.Bundle = &lib.SignatureBundle{}
+		if err := json.Unmarshal(signature, req.Bundle); err != nil {
+			return nil, invalid(err)
+		}
+	}
+
+	document, _, err := requireFile(r, "document")
+	if err != nil {
+		return nil, err
+	}
+	defer document.Close()
+	req.Document = document
+
+	result, err := h.svc.Verify(req)
+	if err != nil {
+		return nil, err
+	}
+	return verified{Valid: true, VerifyResult: result}, nil
+}
@@ -0,0 +1,188 @@
+package rest_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nart4hire/gofze/internal/tsatest"
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/rest"
+	"github.com/nart4hire/gofze/lib/service"
+	"github.com/nart4hire/gofze/lib/store"
+	"github.com/nart4hire/gofze/lib/tsa"
+)
+
+const (
+	template = "00112233445566778899aabbccddeeff"
+	// One bit away from template
+	capture = "00112233445566778899aabbccddeefe"
+)
+
+// post sends a multipart form of fields and files and decodes the answer.
+func post(t *testing.T, url string, fields, files map[string]string) (int, map[string]any) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		w.WriteField(k, v)
+	}
+	for k, v := range files {
+		part, _ := w.CreateFormFile(k, k+".bin")
+		io.WriteString(part, v)
+	}
+	w.Close()
+
+	resp, err := http.Post(url, w.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	answer := map[string]any{}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, answer
+}
+
+// code returns the error code of an answer.
+func code(answer map[string]any) string {
+	e, _ := answer["error"].(map[string]any)
+	c, _ := e["code"].(string)
+	return c
+}
+
+// encode re-encodes an answer to send it back as a file.
+func encode(answer map[string]any) string {
+	b, _ := json.Marshal(answer)
+	return string(b)
+}
+
+func TestHandler(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := filepath.Join(t.TempDir(), "revocations.json")
+	server := httptest.NewServer(NewHandler(&service.Service{Store: s, Revocations: revocations}, 1<<20))
+	defer server.Close()
+
+	status, record := post(t, server.URL+"/v1/enroll", map[string]string{"source": "hex", "length": "16", "subject": "alice"}, map[string]string{"capture": template})
+	if status != http.StatusOK || record["id"] == nil || record["publicKey"] == nil {
+		t.Fatalf("Enroll answered %d %v", status, record)
+	}
+
+	document := "document to sign"
+	status, bundle := post(t, server.URL+"/v1/sign", nil, map[string]string{"enrollment": encode(record), "capture": capture, "document": document})
+	if status != http.StatusOK || bundle["signature"] == nil {
+		t.Fatalf("Sign answered %d %v", status, bundle)
+	}
+	// The stored record of the subject signs with the same key
+	status, stored := post(t, server.URL+"/v1/sign", map[string]string{"subject": "alice"}, map[string]string{"capture": template, "document": document})
+	if status != http.StatusOK || stored["publicKey"] != bundle["publicKey"] {
+		t.Fatalf("Sign by subject answered %d %v", status, stored)
+	}
+
+	status, result := post(t, server.URL+"/v1/verify", map[string]string{}, map[string]string{"signature": encode(bundle), "document": document})
+	if status != http.StatusOK || result["valid"] != true || result["publicKey"] != record["publicKey"] {
+		t.Fatalf("Verify answered %d %v", status, result)
+	}
+
+	cases := []struct {
+		name   string
+		path   string
+		fields map[string]string
+		files  map[string]string
+		status int
+		code   string
+	}{
+		{"tampered document", "/v1/verify", nil, map[string]string{"signature": encode(bundle), "document": document + "!"}, http.StatusUnprocessableEntity, service.KindBadSignature},
+		{"other key", "/v1/verify", map[string]string{"publicKey": "00"}, map[string]string{"signature": encode(bundle), "document": document}, http.StatusUnprocessableEntity, service.KindBadSignature},
+		{"other finger", "/v1/sign", nil, map[string]string{"enrollment": encode(record), "capture": strings.Repeat("f", 32), "document": document}, http.StatusUnauthorized, service.KindNoMatch},
+		{"unknown subject", "/v1/sign", map[string]string{"subject": "bob"}, map[string]string{"capture": template, "document": document}, http.StatusNotFound, service.KindNotFound},
+		{"missing document", "/v1/sign", nil, map[string]string{"enrollment": encode(record), "capture": capture}, http.StatusBadRequest, service.KindInvalid},
+		{"bad length", "/v1/enroll", map[string]string{"source": "hex", "length": "x"}, map[string]string{"capture": template}, http.StatusBadRequest, service.KindInvalid},
+		{"bad image", "/v1/enroll", nil, map[string]string{"capture": "not an image"}, http.StatusBadRequest, service.KindInvalid},
+		{"too large", "/v1/verify", nil, map[string]string{"document": strings.Repeat("x", 1<<21)}, http.StatusRequestEntityTooLarge, "request_too_large"},
+	}
+	for _, c := range cases {
+		status, answer := post(t, server.URL+c.path, c.fields, c.files)
+		if status != c.status || code(answer) != c.code {
+			t.Errorf("%s: answered %d %v", c.name, status, answer)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/v1/sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET answered %d", resp.StatusCode)
+	}
+
+	// Timestamp the signature before the revocation
+	tsaKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tsaTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3161),
+		Subject:      pkix.Name{CommonName: "gofze test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, tsaTemplate, tsaTemplate, tsaKey.Public(), tsaKey)
+	tsaCert, _ := x509.ParseCertificate(der)
+	authority := httptest.NewServer(tsatest.NewResponder(tsaKey, tsaCert))
+	defer authority.Close()
+	signature, _ := base64.StdEncoding.DecodeString(bundle["signature"].(string))
+	token, err := tsa.Timestamp(authority.URL, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamped := map[string]any{"timestamp": token}
+	for k, v := range bundle {
+		stamped[k] = v
+	}
+
+	// Revoked enrollments can neither sign nor be trusted
+	e, _ := s.Get("alice", "")
+	l := &lib.RevocationList{}
+	l.Revoke(lib.Revocation{ID: e.ID, PublicKey: e.PublicKey, RevokedAt: time.Now().Add(time.Minute)})
+	if err := lib.SaveRevocations(revocations, l); err != nil {
+		t.Fatal(err)
+	}
+	if status, answer := post(t, server.URL+"/v1/verify", nil, map[string]string{"signature": encode(bundle), "document": document}); status != http.StatusForbidden || code(answer) != service.KindRevoked {
+		t.Errorf("Revoked key answered %d %v", status, answer)
+	}
+	if status, answer := post(t, server.URL+"/v1/sign", map[string]string{"subject": "alice"}, map[string]string{"capture": template, "document": document}); status != http.StatusForbidden {
+		t.Errorf("Revoked enrollment answered %d %v", status, answer)
+	}
+
+	// Only a timestamp of a trusted authority shows the signature predates
+	// the revocation, as anyone can issue one
+	if status, answer := post(t, server.URL+"/v1/verify", nil, map[string]string{"signature": encode(stamped), "document": document}); status != http.StatusForbidden || code(answer) != service.KindRevoked {
+		t.Errorf("Revoked key with an untrusted timestamp answered %d %v", status, answer)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(tsaCert)
+	trusting := httptest.NewServer(NewHandler(&service.Service{Store: s, Revocations: revocations, TSARoots: roots}, 1<<20))
+	defer trusting.Close()
+	if status, answer := post(t, trusting.URL+"/v1/verify", nil, map[string]string{"signature": encode(stamped), "document": document}); status != http.StatusOK || answer["timestamp"] == nil {
+		t.Errorf("Revoked key with a trusted timestamp answered %d %v", status, answer)
+	}
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Revocation marks an enrollment, and the public key it signed with, as no
+// longer trusted, e.g. because its record leaked. ReplacedBy names the
+// enrollment that took its place when it was rotated.
+type Revocation struct {
+	ID         string    `json:"id"`
+	PublicKey  []byte    `json:"publicKey,omitempty"`
+	RevokedAt  time.Time `json:"revokedAt"`
+	Reason     string    `json:"reason,omitempty"`
+	ReplacedBy string    `json:"replacedBy,omitempty"`
+}
+
+// RevocationList is a local list of revoked enrollments, consulted when
+// signing and verifying.
+type RevocationList struct {
+	Revocations []Revocation `json:"revocations"`
+}
+
+// Revoke adds r to the list, keeping the earliest revocation of an enrollment.
+func (l *RevocationList) Revoke(r Revocation) error {
+	if r.ID == "" && len(r.PublicKey) == 0 {
+		return errors.New("gofze/lib/revocation.go: revocation names no enrollment")
+	}
+	if l.Lookup(r.ID) != nil || l.LookupKey(r.PublicKey) != nil {
+		return nil
+	}
+
+	l.Revocations = append(l.Revocations, r)
+	return nil
+}
+
+// Lookup returns the revocation of the enrollment with the given ID, or nil.
+func (l *RevocationList) Lookup(id string) *Revocation {
+	if id == "" {
+		return nil
+	}
+	for i := range l.Revocations {
+		if l.Revocations[i].ID == id {
+			return &l.Revocations[i]
+		}
+	}
+	return nil
+}
+
+// LookupKey returns the revocation of the given public key, or nil.
+func (l *RevocationList) LookupKey(pub []byte) *Revocation {
+	if len(pub) == 0 {
+		return nil
+	}
+	for i := range l.Revocations {
+		if bytes.Equal(l.Revocations[i].PublicKey, pub) {
+			return &l.Revocations[i]
+		}
+	}
+	return nil
+}
+
+// SaveRevocations writes the list as JSON.
+func SaveRevocations(path string, l *RevocationList) error {
+	b, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+// LoadRevocations reads a list written by SaveRevocations. A missing file is
+// an error, so a mistyped path does not read as a list revoking nothing.
+func LoadRevocations(path string) (*RevocationList, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &RevocationList{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
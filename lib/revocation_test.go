@@ -0,0 +1,56 @@
+package lib_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestRevocationList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	if _, err := LoadRevocations(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Missing list was read")
+	}
+	l := &RevocationList{}
+
+	old, next := NewEnrollmentID(), NewEnrollmentID()
+	if old == next || len(old) != 32 {
+		t.Fatal("Enrollment IDs are not random")
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := l.Revoke(Revocation{ID: old, PublicKey: []byte{1, 2, 3}, RevokedAt: at, ReplacedBy: next}); err != nil {
+		t.Fatal(err)
+	}
+	// Later revocations of the same enrollment keep the first
+	l.Revoke(Revocation{ID: old, RevokedAt: at.Add(time.Hour)})
+	if err := l.Revoke(Revocation{}); err == nil {
+		t.Error("Revocation without an ID or key was accepted")
+	}
+
+	if err := SaveRevocations(path, l); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadRevocations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(l.Revocations) != 1 {
+		t.Fatalf("Expected one revocation, got %d", len(l.Revocations))
+	}
+	if r := l.Lookup(old); r == nil || !r.RevokedAt.Equal(at) || r.ReplacedBy != next {
+		t.Errorf("Unexpected revocation %+v", r)
+	}
+	if l.LookupKey([]byte{1, 2, 3}) == nil {
+		t.Error("Revoked key not found")
+	}
+	if l.Lookup(next) != nil || l.Lookup("") != nil || l.LookupKey(nil) != nil {
+		t.Error("Unrevoked enrollment found")
+	}
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/bits"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Robust helpers carry an HMAC-SHA256 tag over their serialized form, keyed
+// from the extracted key, so Rep rejects helpers whose masks, ciphers, nonces,
+// sample or seed were modified instead of revealing steered bits or returning
+// a wrong key.
+//
+// A tag alone would not stop an attacker who writes a locker that opens to a
+// key of their choosing, such as one with an empty mask whose digest is known
+// without the biometric, and tags it under that key. Robust extractors therefore
+// redraw masks until every locker samples at least one eighth of the bits and
+// refuse helpers with sparser lockers or without a tag. Robust helpers are
+// flagged as such in their header, under the tag, and every extractor then
+// reproduces them as robust whether or not it was built robust itself.
+//
+// Reusability: enrolling the same finger many times is safe as far as the
+// helpers go. Every Gen draws a fresh key, fresh masks and fresh nonces, so
+// two enrollments share no secret but the reading itself, and each locker
+// only gives out a PBKDF2 digest of the sampled bits. What several helpers do
+// give an attacker is more lockers to brute force offline, which is why they
+// can also be sealed (seal.go). Replacing helpers wholesale with ones enrolled
+// from another finger is not caught by the tag, since the attacker knows that
+// key; it is caught by checking signatures against the enrolled public key.
+const tagLength = sha256.Size
+
+// NewRobustFuzzyExtractor is NewGenericFuzzyExtractor producing and requiring
+// authenticated helpers.
+func NewRobustFuzzyExtractor[T Number](blockLength, hammingError int, reproduceError float64, securityLength, nonceLength int, kdf KDFParams) MaskedFuzzyExtractor[T] {
+	fz := newFuzzyExtractor[T](blockLength, hammingError, reproduceError, securityLength, nonceLength, kdf)
+	fz.robust = true
+	return fz
+}
+
+func NewDefaultRobustFuzzyExtractor[T Number](blockLength, hammingError int) MaskedFuzzyExtractor[T] {
+	return NewRobustFuzzyExtractor[T](blockLength, hammingError, 0.001, 2, 16, DefaultKDF)
+}
+
+// IsRobust reports whether the helpers must be reproduced as robust.
+func (h *Helpers[T]) IsRobust() bool {
+	return h.robust
+}
+
+// minWeight is the fewest bits a locker of robust helpers may sample.
+func (fz *fuzzyextractor[T]) minWeight() int {
+	return fz.blockLength * width[T]()
+}
+
+// weight counts the set bits of words.
+func weight[T Number](words []T) int {
+	n := 0
+	for _, word := range words {
+		n += bits.OnesCount64(uint64(word))
+	}
+	return n
+}
+
+// macKey derives the key of the helpers tag from the extracted key.
+func macKey(key []byte) ([]byte, error) {
+	k := make([]byte, tagLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("gofze/robust/v1")), k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// mac computes the tag of the helpers under key.
+func (h *Helpers[T]) mac(key []byte) ([]byte, error) {
+	k, err := macKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header records whether a tag follows, so it is flagged while hashing
+	tagged := *h
+	tagged.tag = []byte{}
+	b, err := tagged.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	m := hmac.New(sha256.New, k)
+	m.Write(b)
+	return m.Sum(nil), nil
+}
+
+// authenticate tags the helpers under the key they lock.
+func (h *Helpers[T]) authenticate(key []byte) error {
+	tag, err := h.mac(key)
+	if err != nil {
+		return err
+	}
+	h.tag = tag
+	return nil
+}
+
+// check verifies the tag of the helpers under a reproduced key.
+func (h *Helpers[T]) check(key []byte) error {
+	tag, err := h.mac(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(tag, h.tag) {
+		return errors.New("gofze/lib/robust.go: helpers failed authentication")
+	}
+	return nil
+}
+
+// checkRobust rejects helpers a robust extractor must not open: untagged
+// ones, and ones with a locker sampling fewer than minWeight bits.
+func (h *Helpers[T]) checkRobust(minWeight int) error {
+	if h.tag == nil {
+		return errors.New("gofze/lib/robust.go: helpers are not authenticated")
+	}
+
+	sampled := make([]T, len(h.masks[0]))
+	for _, mask := range h.masks {
+		for j := range mask {
+			sampled[j] = mask[j]
+			if h.sample != nil {
+				sampled[j] &= h.sample[j]
+			}
+		}
+		if weight(sampled) < minWeight {
+			return errors.New("gofze/lib/robust.go: helpers sample too few bits")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package lib_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const robustValue = "00112233445566778899aabbccddeeff"
+
+// Layout of helpers of a 4 word uint32 extractor with 2 security and 16 nonce
+// words, see serialize.go.
+const (
+	robustHeader = 23
+	robustFlags  = 6
+	robustCipher = 6 * 4
+	robustMask   = 4 * 4
+	robustNonce  = 16 * 4
+	robustTag    = 32
+)
+
+// restore unmarshals serialized uint32 helpers.
+func restore(t *testing.T, b []byte) *Helpers[uint32] {
+	h := &Helpers[uint32]{}
+	if err := h.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestRobustHelpers(t *testing.T) {
+	fe := NewDefaultRobustFuzzyExtractor[uint32](4, 2)
+	key, helpers, err := fe.Gen(robustValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !helpers.IsRobust() {
+		t.Fatal("Robust extractor produced untagged helpers")
+	}
+
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reproduced, err := fe.Rep("00112233445566778899aabbccddeefe", restore(t, b)); err != nil || reproduced != key {
+		t.Fatal("Key not reproduced from restored robust helpers")
+	}
+
+	// Other extractors check the tag of robust helpers too
+	if reproduced, err := NewDefaultFuzzy32Extractor(4, 2).Rep(robustValue, restore(t, b)); err != nil || reproduced != key {
+		t.Error("Robust helpers not opened by the plain extractor")
+	}
+
+	fields := map[string]int{
+		"cipher": robustHeader,
+		"mask":   robustHeader + robustCipher,
+		"nonce":  robustHeader + robustCipher + robustMask,
+		"tag":    len(b) - 1,
+	}
+	for name, at := range fields {
+		tampered := bytes.Clone(b)
+		tampered[at] ^= 1
+		if _, err := fe.Rep(robustValue, restore(t, tampered)); err == nil {
+			t.Errorf("Helpers with a tampered %s were opened", name)
+		}
+	}
+
+	// Robust helpers cannot lose their tag, and dropping the robust flag with
+	// it does not downgrade robust reproduction
+	stripped := bytes.Clone(b[:len(b)-robustTag])
+	stripped[robustFlags] &^= 1 << 2
+	if err := (&Helpers[uint32]{}).UnmarshalBinary(stripped); err == nil {
+		t.Error("Restored robust helpers without a tag")
+	}
+	stripped[robustFlags] &^= 1 << 3
+	if _, err := fe.Rep(robustValue, restore(t, stripped)); err == nil {
+		t.Error("Untagged helpers opened by the robust extractor")
+	}
+}
+
+func TestRobustForgery(t *testing.T) {
+	fe := NewDefaultRobustFuzzyExtractor[uint32](4, 2)
+	_, helpers, err := fe.Gen(robustValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the first locker to sample no bits, so its digest is known
+	// without the reading, and lock a chosen key in it
+	forged := bytes.Clone(b[:len(b)-robustTag])
+	locker := forged[robustHeader:]
+	clear(locker[robustCipher : robustCipher+robustMask])
+	nonce := locker[robustCipher+robustMask : robustCipher+robustMask+robustNonce]
+	digest := pbkdf2.Key(make([]byte, robustMask), nonce, 1, robustCipher, sha256.New)
+	chosen := bytes.Repeat([]byte{0x42}, robustMask)
+	for i := range robustCipher {
+		locker[i] = digest[i]
+		if i < robustMask {
+			locker[i] ^= chosen[i]
+		}
+	}
+
+	macKey := make([]byte, 32)
+	io.ReadFull(hkdf.New(sha256.New, chosen, nil, []byte("gofze/robust/v1")), macKey)
+	tag := func(b []byte) []byte {
+		m := hmac.New(sha256.New, macKey)
+		m.Write(b)
+		return m.Sum(bytes.Clone(b))
+	}
+
+	// The tag is satisfied by the forgery, the weight check is not, and the
+	// helpers are flagged robust for every extractor
+	if _, err := fe.Rep(robustValue, restore(t, tag(forged))); err == nil {
+		t.Error("Robust extractor opened a locker sampling no bits")
+	}
+	if key, err := NewDefaultFuzzy32Extractor(4, 2).Rep(robustValue, restore(t, tag(forged))); err == nil {
+		t.Errorf("Plain extractor opened the forged locker to %s", key)
+	}
+
+	// Without the flag only the tag is checked, which the forgery passes
+	forged[robustFlags] &^= 1 << 3
+	if key, err := NewDefaultFuzzy32Extractor(4, 2).Rep(robustValue, restore(t, tag(forged))); err != nil || key != Key(hex.EncodeToString(chosen)) {
+		t.Error("Forged locker did not open to the chosen key")
+	}
+	if _, err := fe.Rep(robustValue, restore(t, tag(forged))); err == nil {
+		t.Error("Robust extractor opened a locker sampling no bits")
+	}
+}
+
+func TestRobustSparseSample(t *testing.T) {
+	fe := NewDefaultRobustFuzzyExtractor[uint32](4, 2)
+	if _, _, err := fe.GenMasked(robustValue, "0000000f000000000000000000000000"); err == nil {
+		t.Error("Robust helpers generated over too few sampled bits")
+	}
+	if _, _, err := fe.GenMasked(robustValue, "ffffffffffffffffffffffff00000000"); err != nil {
+		t.Error(err)
+	}
+}
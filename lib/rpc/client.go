@@ -0,0 +1,185 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/rpc/gofzepb"
+)
+
+// ChunkSize is the size of the chunks uploads are sent in.
+const ChunkSize = 64 << 10
+
+// Client uploads captures and documents to a gofze server in chunks.
+type Client struct {
+	c gofzepb.GofzeServiceClient
+}
+
+// NewClient returns a client over a connection such as one from
+// grpc.NewClient.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{c: gofzepb.NewGofzeServiceClient(cc)}
+}
+
+// Reason returns the kind of a failure answered by the server, such as
+// "no_match", or "" when err does not carry one.
+func Reason(err error) string {
+	s, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == Domain {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// sendChunks sends r in chunks until it ends. It stops early without error
+// when the server has already answered, which the caller then receives.
+func sendChunks(r io.Reader, send func([]byte) error) error {
+	if r == nil {
+		return nil
+	}
+	buf := make([]byte, ChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			// The chunk is marshalled before Send returns, so buf is reused
+			if err := send(buf[:n]); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Enroll enrolls a capture, telling progress, when set, of the stages of the
+// enrollment.
+func (c *Client) Enroll(ctx context.Context, params *gofzepb.EnrollParams, capture io.Reader, progress func(*gofzepb.Progress)) (*gofzepb.Enrollment, error) {
+	stream, err := c.c.Enroll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&gofzepb.EnrollRequest{Msg: &gofzepb.EnrollRequest_Params{Params: params}}); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	err = sendChunks(capture, func(b []byte) error {
+		return stream.Send(&gofzepb.EnrollRequest{Msg: &gofzepb.EnrollRequest_Capture{Capture: b}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("gofze/lib/rpc/client.go: enrollment ended without a record")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch event := resp.Event.(type) {
+		case *gofzepb.EnrollResponse_Progress:
+			if progress != nil {
+				progress(event.Progress)
+			}
+		case *gofzepb.EnrollResponse_Enrollment:
+			return event.Enrollment, nil
+		}
+	}
+}
+
+// Reproduce checks that a capture reproduces the key of an enrollment.
+func (c *Client) Reproduce(ctx context.Context, params *gofzepb.ReproduceParams, capture io.Reader) (*gofzepb.ReproduceResponse, error) {
+	stream, err := c.c.Reproduce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&gofzepb.ReproduceRequest{Msg: &gofzepb.ReproduceRequest_Params{Params: params}}); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	err = sendChunks(capture, func(b []byte) error {
+		return stream.Send(&gofzepb.ReproduceRequest{Msg: &gofzepb.ReproduceRequest_Capture{Capture: b}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+// Sign signs a document with the key reproduced from a capture.
+func (c *Client) Sign(ctx context.Context, params *gofzepb.SignParams, capture, document io.Reader) (*lib.SignatureBundle, error) {
+	stream, err := c.c.Sign(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Params{Params: params}}); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	err = sendChunks(capture, func(b []byte) error {
+		return stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Capture{Capture: b}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = sendChunks(document, func(b []byte) error {
+		return stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Document{Document: b}})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	sb := &lib.SignatureBundle{}
+	if err := json.Unmarshal(resp.Bundle, sb); err != nil {
+		return nil, err
+	}
+	return sb, nil
+}
+
+// Verify checks a signature bundle over a document, and that it was made by
+// publicKey when given.
+func (c *Client) Verify(ctx context.Context, sb *lib.SignatureBundle, publicKey []byte, document io.Reader) (*gofzepb.VerifyResponse, error) {
+	bundle, err := json.Marshal(sb)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.c.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := &gofzepb.VerifyParams{Bundle: bundle, PublicKey: publicKey}
+	if err := stream.Send(&gofzepb.VerifyRequest{Msg: &gofzepb.VerifyRequest_Params{Params: params}}); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	err = sendChunks(document, func(b []byte) error {
+		return stream.Send(&gofzepb.VerifyRequest{Msg: &gofzepb.VerifyRequest_Document{Document: b}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
@@ -0,0 +1,234 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: gofze/v1/gofze.proto
+
+package gofzepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GofzeService_Enroll_FullMethodName    = "/gofze.v1.GofzeService/Enroll"
+	GofzeService_Reproduce_FullMethodName = "/gofze.v1.GofzeService/Reproduce"
+	GofzeService_Sign_FullMethodName      = "/gofze.v1.GofzeService/Sign"
+	GofzeService_Verify_FullMethodName    = "/gofze.v1.GofzeService/Verify"
+)
+
+// GofzeServiceClient is the client API for GofzeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GofzeService enrolls biometric captures and signs and verifies documents with the
+// keys they reproduce. Captures and documents are uploaded in chunks: every
+// request stream starts with a params message, followed by the capture chunks
+// and then the document chunks. Failures carry a google.rpc.ErrorInfo in the
+// "gofze" domain whose reason is the kind of error, e.g. "no_match".
+type GofzeServiceClient interface {
+	// Enroll enrolls one capture, streaming progress while the lockers are made
+	// and ending with the enrollment record.
+	Enroll(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EnrollRequest, EnrollResponse], error)
+	// Reproduce checks that a capture reproduces the key of an enrollment,
+	// answering with its public key. The key itself never leaves the server.
+	Reproduce(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReproduceRequest, ReproduceResponse], error)
+	// Sign reproduces the key of an enrollment from a capture and signs a
+	// document with it.
+	Sign(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SignRequest, SignResponse], error)
+	// Verify checks a signature bundle over a document.
+	Verify(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[VerifyRequest, VerifyResponse], error)
+}
+
+type gofzeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGofzeServiceClient(cc grpc.ClientConnInterface) GofzeServiceClient {
+	return &gofzeServiceClient{cc}
+}
+
+func (c *gofzeServiceClient) Enroll(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EnrollRequest, EnrollResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GofzeService_ServiceDesc.Streams[0], GofzeService_Enroll_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EnrollRequest, EnrollResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_EnrollClient = grpc.BidiStreamingClient[EnrollRequest, EnrollResponse]
+
+func (c *gofzeServiceClient) Reproduce(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ReproduceRequest, ReproduceResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GofzeService_ServiceDesc.Streams[1], GofzeService_Reproduce_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReproduceRequest, ReproduceResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_ReproduceClient = grpc.ClientStreamingClient[ReproduceRequest, ReproduceResponse]
+
+func (c *gofzeServiceClient) Sign(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SignRequest, SignResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GofzeService_ServiceDesc.Streams[2], GofzeService_Sign_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SignRequest, SignResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_SignClient = grpc.ClientStreamingClient[SignRequest, SignResponse]
+
+func (c *gofzeServiceClient) Verify(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[VerifyRequest, VerifyResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GofzeService_ServiceDesc.Streams[3], GofzeService_Verify_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[VerifyRequest, VerifyResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_VerifyClient = grpc.ClientStreamingClient[VerifyRequest, VerifyResponse]
+
+// GofzeServiceServer is the server API for GofzeService service.
+// All implementations must embed UnimplementedGofzeServiceServer
+// for forward compatibility.
+//
+// GofzeService enrolls biometric captures and signs and verifies documents with the
+// keys they reproduce. Captures and documents are uploaded in chunks: every
+// request stream starts with a params message, followed by the capture chunks
+// and then the document chunks. Failures carry a google.rpc.ErrorInfo in the
+// "gofze" domain whose reason is the kind of error, e.g. "no_match".
+type GofzeServiceServer interface {
+	// Enroll enrolls one capture, streaming progress while the lockers are made
+	// and ending with the enrollment record.
+	Enroll(grpc.BidiStreamingServer[EnrollRequest, EnrollResponse]) error
+	// Reproduce checks that a capture reproduces the key of an enrollment,
+	// answering with its public key. The key itself never leaves the server.
+	Reproduce(grpc.ClientStreamingServer[ReproduceRequest, ReproduceResponse]) error
+	// Sign reproduces the key of an enrollment from a capture and signs a
+	// document with it.
+	Sign(grpc.ClientStreamingServer[SignRequest, SignResponse]) error
+	// Verify checks a signature bundle over a document.
+	Verify(grpc.ClientStreamingServer[VerifyRequest, VerifyResponse]) error
+	mustEmbedUnimplementedGofzeServiceServer()
+}
+
+// UnimplementedGofzeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGofzeServiceServer struct{}
+
+func (UnimplementedGofzeServiceServer) Enroll(grpc.BidiStreamingServer[EnrollRequest, EnrollResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Enroll not implemented")
+}
+func (UnimplementedGofzeServiceServer) Reproduce(grpc.ClientStreamingServer[ReproduceRequest, ReproduceResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Reproduce not implemented")
+}
+func (UnimplementedGofzeServiceServer) Sign(grpc.ClientStreamingServer[SignRequest, SignResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Sign not implemented")
+}
+func (UnimplementedGofzeServiceServer) Verify(grpc.ClientStreamingServer[VerifyRequest, VerifyResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedGofzeServiceServer) mustEmbedUnimplementedGofzeServiceServer() {}
+func (UnimplementedGofzeServiceServer) testEmbeddedByValue()                      {}
+
+// UnsafeGofzeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GofzeServiceServer will
+// result in compilation errors.
+type UnsafeGofzeServiceServer interface {
+	mustEmbedUnimplementedGofzeServiceServer()
+}
+
+func RegisterGofzeServiceServer(s grpc.ServiceRegistrar, srv GofzeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGofzeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GofzeService_ServiceDesc, srv)
+}
+
+func _GofzeService_Enroll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GofzeServiceServer).Enroll(&grpc.GenericServerStream[EnrollRequest, EnrollResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_EnrollServer = grpc.BidiStreamingServer[EnrollRequest, EnrollResponse]
+
+func _GofzeService_Reproduce_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GofzeServiceServer).Reproduce(&grpc.GenericServerStream[ReproduceRequest, ReproduceResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_ReproduceServer = grpc.ClientStreamingServer[ReproduceRequest, ReproduceResponse]
+
+func _GofzeService_Sign_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GofzeServiceServer).Sign(&grpc.GenericServerStream[SignRequest, SignResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_SignServer = grpc.ClientStreamingServer[SignRequest, SignResponse]
+
+func _GofzeService_Verify_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GofzeServiceServer).Verify(&grpc.GenericServerStream[VerifyRequest, VerifyResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GofzeService_VerifyServer = grpc.ClientStreamingServer[VerifyRequest, VerifyResponse]
+
+// GofzeService_ServiceDesc is the grpc.ServiceDesc for GofzeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GofzeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gofze.v1.GofzeService",
+	HandlerType: (*GofzeServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Enroll",
+			Handler:       _GofzeService_Enroll_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Reproduce",
+			Handler:       _GofzeService_Reproduce_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Sign",
+			Handler:       _GofzeService_Sign_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Verify",
+			Handler:       _GofzeService_Verify_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gofze/v1/gofze.proto",
+}
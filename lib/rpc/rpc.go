@@ -0,0 +1,443 @@
+// Package rpc serves enrollment, signing and verification over gRPC, with the
+// service defined in proto/gofze/v1/gofze.proto. Captures and documents are
+// uploaded in chunks on client streams, so documents of any size are signed
+// without being held in memory, and Enroll streams its progress back while
+// the lockers are made. The gofzepb package holds the generated code, and
+// Client wraps it for Go applications.
+package rpc
+
+//go:generate buf generate
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/rpc/gofzepb"
+	"github.com/nart4hire/gofze/lib/service"
+)
+
+// Domain of the google.rpc.ErrorInfo carried by failures.
+const Domain = "gofze"
+
+// MaxCapture bounds the size of an uploaded capture, which is held in memory.
+const MaxCapture = 16 << 20
+
+// Parts of a request stream, in the order they are sent.
+const (
+	partParams = iota
+	partCapture
+	partDocument
+)
+
+var partNames = []string{"params", "capture", "document"}
+
+var statusCodes = map[string]codes.Code{
+	service.KindInvalid:      codes.InvalidArgument,
+	service.KindNotFound:     codes.NotFound,
+	service.KindNoMatch:      codes.Unauthenticated,
+	service.KindBadSignature: codes.FailedPrecondition,
+	service.KindRevoked:      codes.PermissionDenied,
+	service.KindInternal:     codes.Internal,
+}
+
+type server struct {
+	gofzepb.UnimplementedGofzeServiceServer
+	svc *service.Service
+}
+
+// NewServer serves svc over gRPC, to be registered with
+// gofzepb.RegisterGofzeServiceServer.
+func NewServer(svc *service.Service) gofzepb.GofzeServiceServer {
+	return &server{svc: svc}
+}
+
+// invalid marks a malformed request.
+func invalid(err error) error {
+	return &service.Error{Kind: service.KindInvalid, Err: err}
+}
+
+// toStatus converts err to a status with the ErrorInfo of its kind, leaving
+// internal errors undescribed. Errors of the transport keep their status.
+func toStatus(method string, err error) error {
+	if s, ok := status.FromError(err); ok {
+		return s.Err()
+	}
+
+	kind := service.KindOf(err)
+	message := err.Error()
+	if kind == service.KindInternal {
+		log.Printf("Error in %s: %v", method, err)
+		message = "internal error"
+	}
+	s := status.New(statusCodes[kind], message)
+	if d, err := s.WithDetails(&errdetails.ErrorInfo{Reason: kind, Domain: Domain}); err == nil {
+		s = d
+	}
+	return s.Err()
+}
+
+// upload reads the parts of a request stream after its params. A chunk of the
+// next part ends the current one and is held until that part is read.
+type upload struct {
+	recv func() (part int, data []byte, err error)
+	held bool
+	part int
+	data []byte
+	err  error
+}
+
+// next holds the next chunk unless one is held already.
+func (u *upload) next() {
+	if !u.held && u.err == nil {
+		u.part, u.data, u.err = u.recv()
+		u.held = u.err == nil
+	}
+}
+
+// reader reads the chunks of part until a chunk of another part comes.
+func (u *upload) reader(part int) io.Reader {
+	return &partReader{u: u, part: part}
+}
+
+// readAll reads a part into memory, up to max bytes.
+func (u *upload) readAll(part int, max int64) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(u.reader(part), max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, invalid(errors.New(partNames[part] + " is too large"))
+	}
+	return b, nil
+}
+
+// end checks that the stream ended after the parts that were read.
+func (u *upload) end() error {
+	u.next()
+	if u.held {
+		return invalid(errors.New("unexpected " + partNames[u.part] + " chunk"))
+	}
+	if u.err != io.EOF {
+		return u.err
+	}
+	return nil
+}
+
+type partReader struct {
+	u    *upload
+	part int
+}
+
+func (r *partReader) Read(b []byte) (int, error) {
+	for {
+		r.u.next()
+		if !r.u.held {
+			return 0, r.u.err
+		}
+		if r.u.part != r.part {
+			return 0, io.EOF
+		}
+		if len(r.u.data) > 0 {
+			n := copy(b, r.u.data)
+			r.u.data = r.u.data[n:]
+			return n, nil
+		}
+		r.u.held = false
+	}
+}
+
+// recvChunk adapts the Recv of a stream to upload, rejecting params after
+// the first message.
+func recvChunk[T any](recv func() (*T, error), chunk func(*T) (int, []byte)) func() (int, []byte, error) {
+	return func() (int, []byte, error) {
+		m, err := recv()
+		if err != nil {
+			return 0, nil, err
+		}
+		part, data := chunk(m)
+		if part == partParams {
+			return 0, nil, invalid(errors.New("params may only be sent first"))
+		}
+		return part, data, nil
+	}
+}
+
+// first receives the params a request stream starts with.
+func first[T, P any](recv func() (*T, error), params func(*T) *P) (*P, error) {
+	m, err := recv()
+	if errors.Is(err, io.EOF) {
+		return nil, invalid(errors.New("empty request"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := params(m)
+	if p == nil {
+		return nil, invalid(errors.New("the request must start with params"))
+	}
+	return p, nil
+}
+
+// credential converts a credential message.
+func credential(c *gofzepb.Credential) lib.Credential {
+	return lib.Credential{Password: c.GetPassword(), Identity: c.GetIdentity()}
+}
+
+// record parses the enrollment record of a request, if any.
+func record(b []byte) (*lib.Enrollment, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	e, err := lib.ParseEnrollment(b)
+	if err != nil {
+		return nil, invalid(err)
+	}
+	return e, nil
+}
+
+func enrollChunk(m *gofzepb.EnrollRequest) (int, []byte) {
+	switch msg := m.Msg.(type) {
+	case *gofzepb.EnrollRequest_Capture:
+		return partCapture, msg.Capture
+	}
+	return partParams, nil
+}
+
+func (s *server) Enroll(stream grpc.BidiStreamingServer[gofzepb.EnrollRequest, gofzepb.EnrollResponse]) error {
+	err := s.enroll(stream)
+	if err != nil {
+		return toStatus("Enroll", err)
+	}
+	return nil
+}
+
+func (s *server) enroll(stream grpc.BidiStreamingServer[gofzepb.EnrollRequest, gofzepb.EnrollResponse]) error {
+	params, err := first(stream.Recv, (*gofzepb.EnrollRequest).GetParams)
+	if err != nil {
+		return err
+	}
+	u := &upload{recv: recvChunk(stream.Recv, enrollChunk)}
+	capture, err := u.readAll(partCapture, MaxCapture)
+	if err != nil {
+		return err
+	}
+	if err := u.end(); err != nil {
+		return err
+	}
+
+	// Report every stage but only every hundredth of the lockers
+	var sendErr error
+	progress := func(stage string, done, total int) {
+		if sendErr != nil {
+			return
+		}
+		if stage == service.StageLockers && done != total && done%max(total/100, 1) != 0 {
+			return
+		}
+		sendErr = stream.Send(&gofzepb.EnrollResponse{Event: &gofzepb.EnrollResponse_Progress{
+			Progress: &gofzepb.Progress{Stage: stage, Done: int32(done), Total: int32(total)},
+		}})
+	}
+
+	e, err := s.svc.Enroll(service.EnrollRequest{
+		Subject:      params.Subject,
+		Source:       params.Source,
+		Minutiae:     int(params.Minutiae),
+		Length:       int(params.Length),
+		Aligned:      params.Aligned,
+		HammingError: int(params.HammingError),
+		Robust:       params.Robust,
+		KeyContext:   params.KeyContext,
+		Algorithm:    params.Algorithm,
+		Password:     params.Password,
+		Recipient:    params.Recipient,
+		Capture:      capture,
+		Progress:     progress,
+	})
+	if err != nil {
+		return err
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+
+	b, err := lib.MarshalEnrollment(e)
+	if err != nil {
+		return err
+	}
+	return stream.Send(&gofzepb.EnrollResponse{Event: &gofzepb.EnrollResponse_Enrollment{
+		Enrollment: &gofzepb.Enrollment{Id: e.ID, Algorithm: e.Algorithm, PublicKey: e.PublicKey, Record: b},
+	}})
+}
+
+func reproduceChunk(m *gofzepb.ReproduceRequest) (int, []byte) {
+	switch msg := m.Msg.(type) {
+	case *gofzepb.ReproduceRequest_Capture:
+		return partCapture, msg.Capture
+	}
+	return partParams, nil
+}
+
+func (s *server) Reproduce(stream grpc.ClientStreamingServer[gofzepb.ReproduceRequest, gofzepb.ReproduceResponse]) error {
+	err := s.reproduce(stream)
+	if err != nil {
+		return toStatus("Reproduce", err)
+	}
+	return nil
+}
+
+func (s *server) reproduce(stream grpc.ClientStreamingServer[gofzepb.ReproduceRequest, gofzepb.ReproduceResponse]) error {
+	params, err := first(stream.Recv, (*gofzepb.ReproduceRequest).GetParams)
+	if err != nil {
+		return err
+	}
+	u := &upload{recv: recvChunk(stream.Recv, reproduceChunk)}
+	req := service.ReproduceRequest{
+		Subject:    params.Subject,
+		Credential: credential(params.Credential),
+		Algorithm:  params.Algorithm,
+	}
+	if req.Enrollment, err = record(params.Record); err != nil {
+		return err
+	}
+	if req.Capture, err = u.readAll(partCapture, MaxCapture); err != nil {
+		return err
+	}
+	if err := u.end(); err != nil {
+		return err
+	}
+
+	signer, e, err := s.svc.Reproduce(req)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&gofzepb.ReproduceResponse{
+		EnrollmentId: e.ID,
+		Algorithm:    signer.Algorithm(),
+		PublicKey:    signer.PublicKey(),
+	})
+}
+
+func signChunk(m *gofzepb.SignRequest) (int, []byte) {
+	switch msg := m.Msg.(type) {
+	case *gofzepb.SignRequest_Capture:
+		return partCapture, msg.Capture
+	case *gofzepb.SignRequest_Document:
+		return partDocument, msg.Document
+	}
+	return partParams, nil
+}
+
+func (s *server) Sign(stream grpc.ClientStreamingServer[gofzepb.SignRequest, gofzepb.SignResponse]) error {
+	err := s.sign(stream)
+	if err != nil {
+		return toStatus("Sign", err)
+	}
+	return nil
+}
+
+func (s *server) sign(stream grpc.ClientStreamingServer[gofzepb.SignRequest, gofzepb.SignResponse]) error {
+	params, err := first(stream.Recv, (*gofzepb.SignRequest).GetParams)
+	if err != nil {
+		return err
+	}
+	u := &upload{recv: recvChunk(stream.Recv, signChunk)}
+	req := service.SignRequest{
+		ReproduceRequest: service.ReproduceRequest{
+			Subject:    params.Subject,
+			Credential: credential(params.Credential),
+			Algorithm:  params.Algorithm,
+		},
+		Digest:      params.Digest,
+		Filename:    params.Filename,
+		ContentType: params.ContentType,
+		Document:    u.reader(partDocument),
+	}
+	if req.Enrollment, err = record(params.Record); err != nil {
+		return err
+	}
+	if req.Capture, err = u.readAll(partCapture, MaxCapture); err != nil {
+		return err
+	}
+
+	sb, err := s.svc.Sign(req)
+	if err != nil {
+		return err
+	}
+	if err := u.end(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(sb)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&gofzepb.SignResponse{Bundle: b})
+}
+
+func verifyChunk(m *gofzepb.VerifyRequest) (int, []byte) {
+	switch msg := m.Msg.(type) {
+	case *gofzepb.VerifyRequest_Document:
+		return partDocument, msg.Document
+	}
+	return partParams, nil
+}
+
+func (s *server) Verify(stream grpc.ClientStreamingServer[gofzepb.VerifyRequest, gofzepb.VerifyResponse]) error {
+	err := s.verify(stream)
+	if err != nil {
+		return toStatus("Verify", err)
+	}
+	return nil
+}
+
+func (s *server) verify(stream grpc.ClientStreamingServer[gofzepb.VerifyRequest, gofzepb.VerifyResponse]) error {
+	params, err := first(stream.Recv, (*gofzepb.VerifyRequest).GetParams)
+	if err != nil {
+		return err
+	}
+	u := &upload{recv: recvChunk(stream.Recv, verifyChunk)}
+	req := service.VerifyRequest{Document: u.reader(partDocument)}
+	if len(params.PublicKey) > 0 {
+		req.PublicKey = params.PublicKey
+	}
+	if len(params.Bundle) > 0 {
+		req.Bundle = &lib.SignatureBundle{}
+		if err := json.Unmarshal(params.Bundle, req.Bundle); err != nil {
+			return invalid(err)
+		}
+	}
+
+	result, err := s.svc.Verify(req)
+	if err != nil {
+		return err
+	}
+	if err := u.end(); err != nil {
+		return err
+	}
+
+	resp := &gofzepb.VerifyResponse{Algorithm: result.Algorithm, PublicKey: result.PublicKey}
+	if a := result.Attributes; a != nil {
+		resp.Attributes = &gofzepb.Attributes{
+			SigningTime: timestamppb.New(a.SigningTime),
+			SignerId:    a.SignerID,
+			ContentType: a.ContentType,
+			Filename:    a.Filename,
+			Version:     a.Version,
+			ParamsHash:  a.ParamsHash,
+		}
+	}
+	if result.Timestamp != nil {
+		resp.Timestamp = timestamppb.New(*result.Timestamp)
+	}
+	return stream.SendAndClose(resp)
+}
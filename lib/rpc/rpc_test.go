@@ -0,0 +1,171 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/rpc"
+	"github.com/nart4hire/gofze/lib/rpc/gofzepb"
+	"github.com/nart4hire/gofze/lib/service"
+	"github.com/nart4hire/gofze/lib/store"
+)
+
+const (
+	template = "00112233445566778899aabbccddeeff"
+	// One bit away from template
+	capture = "00112233445566778899aabbccddeefe"
+)
+
+// serve runs svc in process and returns a client to it.
+func serve(t *testing.T, svc *service.Service) (*Client, *grpc.ClientConn) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	gofzepb.RegisterGofzeServiceServer(server, NewServer(svc))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	cc, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return NewClient(cc), cc
+}
+
+func TestServer(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations := filepath.Join(t.TempDir(), "revocations.json")
+	client, cc := serve(t, &service.Service{Store: s, Revocations: revocations})
+	ctx := context.Background()
+
+	stages := map[string]bool{}
+	lockers := 0
+	enrollment, err := client.Enroll(ctx, &gofzepb.EnrollParams{Source: "hex", Length: 16, Subject: "alice"}, strings.NewReader(template), func(p *gofzepb.Progress) {
+		stages[p.Stage] = true
+		if p.Stage == service.StageLockers && p.Done == p.Total {
+			lockers = int(p.Total)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enrollment.Id == "" || enrollment.PublicKey == nil || enrollment.Record == nil {
+		t.Fatalf("Unexpected enrollment %v", enrollment)
+	}
+	if !stages[service.StageFeatures] || !stages[service.StageLockers] || lockers == 0 {
+		t.Errorf("Expected the progress of every locker, got %v", stages)
+	}
+
+	reproduced, err := client.Reproduce(ctx, &gofzepb.ReproduceParams{Subject: "alice"}, strings.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reproduced.EnrollmentId != enrollment.Id || string(reproduced.PublicKey) != string(enrollment.PublicKey) {
+		t.Errorf("Reproduced another key %v", reproduced)
+	}
+
+	// Documents span many chunks
+	document := strings.Repeat("document to sign ", 1<<14)
+	sb, err := client.Sign(ctx, &gofzepb.SignParams{Record: enrollment.Record, Filename: "doc.txt"}, strings.NewReader(capture), strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.Verify([]byte(document)); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.Verify(ctx, sb, enrollment.PublicKey, strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Attributes.GetFilename() != "doc.txt" || result.Attributes.GetSigningTime().AsTime().IsZero() {
+		t.Errorf("Unexpected attributes %v", result.Attributes)
+	}
+
+	cases := []struct {
+		name   string
+		call   func() error
+		code   codes.Code
+		reason string
+	}{
+		{"tampered document", func() error {
+			_, err := client.Verify(ctx, sb, nil, strings.NewReader(document+"!"))
+			return err
+		}, codes.FailedPrecondition, service.KindBadSignature},
+		{"other finger", func() error {
+			_, err := client.Sign(ctx, &gofzepb.SignParams{Subject: "alice"}, strings.NewReader(strings.Repeat("f", 32)), strings.NewReader(document))
+			return err
+		}, codes.Unauthenticated, service.KindNoMatch},
+		{"unknown subject", func() error {
+			_, err := client.Reproduce(ctx, &gofzepb.ReproduceParams{Subject: "bob"}, strings.NewReader(template))
+			return err
+		}, codes.NotFound, service.KindNotFound},
+		{"bad record", func() error {
+			_, err := client.Reproduce(ctx, &gofzepb.ReproduceParams{Record: []byte("{")}, strings.NewReader(template))
+			return err
+		}, codes.InvalidArgument, service.KindInvalid},
+		{"too large", func() error {
+			_, err := client.Enroll(ctx, &gofzepb.EnrollParams{Source: "hex", Length: 16}, strings.NewReader(strings.Repeat("0", MaxCapture+1)), nil)
+			return err
+		}, codes.InvalidArgument, service.KindInvalid},
+	}
+	for _, c := range cases {
+		err := c.call()
+		if status.Code(err) != c.code || Reason(err) != c.reason {
+			t.Errorf("%s: answered %v (%s)", c.name, err, Reason(err))
+		}
+	}
+
+	// Streams must start with params and send their parts in order
+	stream, err := gofzepb.NewGofzeServiceClient(cc).Sign(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Params{Params: &gofzepb.SignParams{Record: enrollment.Record}}})
+	stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Capture{Capture: []byte(capture)}})
+	stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Document{Document: []byte(document)}})
+	stream.Send(&gofzepb.SignRequest{Msg: &gofzepb.SignRequest_Capture{Capture: []byte(capture)}})
+	if _, err := stream.CloseAndRecv(); Reason(err) != service.KindInvalid {
+		t.Errorf("Out of order parts answered %v", err)
+	}
+	verify, err := gofzepb.NewGofzeServiceClient(cc).Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify.Send(&gofzepb.VerifyRequest{Msg: &gofzepb.VerifyRequest_Document{Document: []byte(document)}})
+	if _, err := verify.CloseAndRecv(); Reason(err) != service.KindInvalid {
+		t.Errorf("Missing params answered %v", err)
+	}
+
+	// Revoked enrollments can neither sign nor be trusted
+	e, _ := s.Get("alice", "")
+	l := &lib.RevocationList{}
+	l.Revoke(lib.Revocation{ID: e.ID, PublicKey: e.PublicKey, RevokedAt: time.Now()})
+	if err := lib.SaveRevocations(revocations, l); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Verify(ctx, sb, nil, strings.NewReader(document)); status.Code(err) != codes.PermissionDenied || Reason(err) != service.KindRevoked {
+		t.Errorf("Revoked key answered %v", err)
+	}
+	if _, err := client.Reproduce(ctx, &gofzepb.ReproduceParams{Subject: "alice"}, strings.NewReader(template)); Reason(err) != service.KindRevoked {
+		t.Errorf("Revoked enrollment answered %v", err)
+	}
+}
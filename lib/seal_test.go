@@ -0,0 +1,85 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestSealedEnrollment(t *testing.T) {
+	fe := NewDefaultFuzzy32Extractor(4, 2)
+	key, helpers, err := fe.Gen("00112233445566778899aabbccddeeff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity, recipient, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := []byte("correct horse battery staple")
+
+	byPassword, err := SealPassword(b, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byRecipient, err := SealRecipient(b, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		sealed []byte
+		right  Credential
+		wrong  Credential
+	}{
+		{byPassword, Credential{Password: password}, Credential{Password: []byte("wrong")}},
+		{byRecipient, Credential{Identity: identity}, Credential{Password: password}},
+	}
+	for i, c := range cases {
+		if !IsSealed(c.sealed) || bytes.Contains(c.sealed, b[23:]) {
+			t.Fatalf("Case %d: helpers are not sealed", i)
+		}
+
+		// Reproduction is unchanged once the record is opened
+		e := &Enrollment{Helpers: c.sealed}
+		opened, err := e.OpenHelpers(c.right)
+		if err != nil {
+			t.Fatalf("Case %d: %v", i, err)
+		}
+		restored := &Helpers[uint32]{}
+		if err := restored.UnmarshalBinary(opened); err != nil {
+			t.Fatal(err)
+		}
+		if reproduced, err := fe.Rep("00112233445566778899aabbccddeeff", restored); err != nil || reproduced != key {
+			t.Errorf("Case %d: key not reproduced from sealed helpers", i)
+		}
+
+		if _, err := e.OpenHelpers(c.wrong); err == nil {
+			t.Errorf("Case %d: opened with the wrong credential", i)
+		}
+		if _, err := e.OpenHelpers(Credential{}); err == nil {
+			t.Errorf("Case %d: opened without a credential", i)
+		}
+
+		// Header and ciphertext are both authenticated
+		for _, at := range []int{7, len(c.sealed) - 1} {
+			tampered := bytes.Clone(c.sealed)
+			tampered[at] ^= 1
+			if _, err := Open(tampered, c.right); err == nil {
+				t.Errorf("Case %d: tampered byte %d opened", i, at)
+			}
+		}
+	}
+
+	// Records without sealing are read as they are
+	plain := &Enrollment{Helpers: b}
+	if opened, err := plain.OpenHelpers(Credential{}); err != nil || !bytes.Equal(opened, b) {
+		t.Error("Unsealed helpers were not passed through")
+	}
+}
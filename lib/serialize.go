@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Serialized helpers start with a magic, a format version and the word width
+// in bytes, followed by big endian uint32 counts and the big endian words:
+//
+//	"GFZH" | version | width | flags | lockers | block | cipher | nonce
+//	[sample words] [seed length | seed] (cipher | mask | nonce words)... [tag]
+const (
+	helpersMagic   = "GFZH"
+	helpersVersion = 1
+)
+
+// Header flags. Robust helpers always carry a tag, which covers the flags.
+const (
+	helpersSample = 1 << iota
+	helpersSeed
+	helpersTag
+	helpersRobust
+)
+
+func width[T Number]() int {
+	return bits.Len64(uint64(^T(0))) / 8
+}
+
+func appendWords[T Number](b []byte, words []T) []byte {
+	w := width[T]()
+	for _, word := range words {
+		for shift := (w - 1) * 8; shift >= 0; shift -= 8 {
+			b = append(b, byte(uint64(word)>>shift))
+		}
+	}
+	return b
+}
+
+func readWords[T Number](b []byte, count int) ([]T, []byte, error) {
+	w := width[T]()
+	if count < 0 || len(b) < count*w {
+		return nil, nil, errors.New("gofze/lib/serialize.go: truncated helpers")
+	}
+
+	words := make([]T, count)
+	for i := range words {
+		var word uint64
+		for _, c := range b[i*w : (i+1)*w] {
+			word = word<<8 | uint64(c)
+		}
+		words[i] = T(word)
+	}
+	return words, b[count*w:], nil
+}
+
+// MarshalBinary serializes the helpers so they can be stored with an enrollment.
+func (h *Helpers[T]) MarshalBinary() ([]byte, error) {
+	b, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append(b, h.tag...), nil
+}
+
+// marshal serializes everything but the tag, which authenticates the rest.
+func (h *Helpers[T]) marshal() ([]byte, error) {
+	if len(h.ciphers) == 0 || len(h.masks) != len(h.ciphers) || len(h.nonces) != len(h.ciphers) {
+		return nil, errors.New("gofze/lib/serialize.go: malformed helpers")
+	}
+
+	block, cipher, nonce := len(h.masks[0]), len(h.ciphers[0]), len(h.nonces[0])
+	var flags byte
+	if h.sample != nil {
+		flags |= helpersSample
+	}
+	if h.seed != nil {
+		flags |= helpersSeed
+	}
+	if h.tag != nil {
+		flags |= helpersTag
+	}
+	if h.robust {
+		flags |= helpersRobust
+	}
+
+	b := append([]byte(helpersMagic), helpersVersion, byte(width[T]()), flags)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(h.ciphers)))
+	b = binary.BigEndian.AppendUint32(b, uint32(block))
+	b = binary.BigEndian.AppendUint32(b, uint32(cipher))
+	b = binary.BigEndian.AppendUint32(b, uint32(nonce))
+
+	if h.sample != nil {
+		if len(h.sample) != block {
+			return nil, errors.New("gofze/lib/serialize.go: malformed helpers")
+		}
+		b = appendWords(b, h.sample)
+	}
+	if h.seed != nil {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(h.seed)))
+		b = append(b, h.seed...)
+	}
+
+	for i := range h.ciphers {
+		if len(h.ciphers[i]) != cipher || len(h.masks[i]) != block || len(h.nonces[i]) != nonce {
+			return nil, errors.New("gofze/lib/serialize.go: malformed helpers")
+		}
+		b = appendWords(b, h.ciphers[i])
+		b = appendWords(b, h.masks[i])
+		b = appendWords(b, h.nonces[i])
+	}
+	return b, nil
+}
+
+// UnmarshalBinary restores helpers written by MarshalBinary for the same word width.
+func (h *Helpers[T]) UnmarshalBinary(data []byte) error {
+	if len(data) < 23 || string(data[:4]) != helpersMagic {
+		return errors.New("gofze/lib/serialize.go: invalid helpers")
+	}
+
+	if data[4] != helpersVersion {
+		return errors.New("gofze/lib/serialize.go: unsupported helpers version")
+	}
+
+	if int(data[5]) != width[T]() {
+		return errors.New("gofze/lib/serialize.go: helpers word width mismatch")
+	}
+
+	flags := data[6]
+	lockers := int(binary.BigEndian.Uint32(data[7:]))
+	block := int(binary.BigEndian.Uint32(data[11:]))
+	cipher := int(binary.BigEndian.Uint32(data[15:]))
+	nonce := int(binary.BigEndian.Uint32(data[19:]))
+	rest := data[23:]
+
+	if lockers <= 0 || block <= 0 || cipher < block || nonce <= 0 {
+		return errors.New("gofze/lib/serialize.go: invalid helpers")
+	}
+
+	// Reject counts that cannot fit before allocating for them
+	if cipher > len(rest) || lockers > len(rest)/((cipher+block+nonce)*width[T]()) {
+		return errors.New("gofze/lib/serialize.go: truncated helpers")
+	}
+
+	var err error
+	var sample []T
+	if flags&helpersSample != 0 {
+		if sample, rest, err = readWords[T](rest, block); err != nil {
+			return err
+		}
+	}
+
+	var seed []byte
+	if flags&helpersSeed != 0 {
+		if len(rest) < 4 {
+			return errors.New("gofze/lib/serialize.go: truncated helpers")
+		}
+		n := int(binary.BigEndian.Uint32(rest))
+		if len(rest) < 4+n {
+			return errors.New("gofze/lib/serialize.go: truncated helpers")
+		}
+		seed, rest = append([]byte{}, rest[4:4+n]...), rest[4+n:]
+	}
+
+	ciphers := make([][]T, lockers)
+	masks := make([][]T, lockers)
+	nonces := make([][]T, lockers)
+	for i := range lockers {
+		if ciphers[i], rest, err = readWords[T](rest, cipher); err != nil {
+			return err
+		}
+		if masks[i], rest, err = readWords[T](rest, block); err != nil {
+			return err
+		}
+		if nonces[i], rest, err = readWords[T](rest, nonce); err != nil {
+			return err
+		}
+	}
+
+	var tag []byte
+	if flags&helpersTag != 0 {
+		if len(rest) < tagLength {
+			return errors.New("gofze/lib/serialize.go: truncated helpers")
+		}
+		tag, rest = append([]byte{}, rest[:tagLength]...), rest[tagLength:]
+	}
+
+	if len(rest) != 0 {
+		return errors.New("gofze/lib/serialize.go: trailing helpers data")
+	}
+	robust := flags&helpersRobust != 0
+	if robust && tag == nil {
+		return errors.New("gofze/lib/serialize.go: robust helpers without a tag")
+	}
+
+	*h = Helpers[T]{
+		ciphers: ciphers,
+		masks:   masks,
+		nonces:  nonces,
+		sample:  sample,
+		seed:    seed,
+		tag:     tag,
+		robust:  robust,
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package lib_test
+
+import (
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestHelpersBinary(t *testing.T) {
+	fe := NewDefaultFuzzy32Extractor(4, 2)
+	key, helpers, err := fe.GenMasked("00112233445566778899aabbccddeeff", "ffffffffffffffffffffffff00000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := &Helpers[uint32]{}
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := fe.Rep("00112233445566778899aabb00000000", restored)
+	if err != nil {
+		t.Fatal("Failed to reproduce key from restored helpers")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	if err := (&Helpers[byte]{}).UnmarshalBinary(b); err == nil {
+		t.Error("Expected word width mismatch")
+	}
+
+	if err := (&Helpers[uint32]{}).UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("Expected truncated helpers to be rejected")
+	}
+
+	if _, err := NewDefaultFuzzy32Extractor(8, 2).Rep("00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff", restored); err == nil {
+		t.Error("Expected helpers of another block length to be rejected")
+	}
+}
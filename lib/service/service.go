@@ -0,0 +1,456 @@
+// Package service enrolls, signs and verifies with in-memory captures and
+// documents, for the network front ends of gofze serve. Single captures are
+// enrolled per request; records enrolled from several captures or fingers by
+// the CLI are reproduced there. Failures are returned as *Error with a Kind
+// the front ends map to their status codes.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+	"github.com/nart4hire/gofze/lib/store"
+	"github.com/nart4hire/gofze/lib/tsa"
+)
+
+// Kinds of Error.
+const (
+	KindInvalid      = "invalid_request"
+	KindNotFound     = "not_found"
+	KindNoMatch      = "no_match"
+	KindBadSignature = "invalid_signature"
+	KindRevoked      = "revoked"
+	KindInternal     = "internal"
+)
+
+// Defaults of EnrollRequest.
+const (
+	DefaultSource       = "fingerprint"
+	DefaultHammingError = 4
+)
+
+// Stages reported to EnrollRequest.Progress.
+const (
+	StageFeatures = "features"
+	StageLockers  = "lockers"
+	StageSealing  = "sealing"
+)
+
+// maxPixels bounds the size of uploaded fingerprint images, which are decoded
+// in full.
+const maxPixels = 4096 * 4096
+
+// Error is a failure of the request rather than of the service when Kind is
+// not KindInternal.
+type Error struct {
+	Kind string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// fail classifies err, keeping the kind it already has.
+func fail(kind string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of err, KindInternal when it was not classified.
+func KindOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return KindNotFound
+	}
+	return KindInternal
+}
+
+// Service holds what requests share. Every field is optional: without a
+// store requests carry their enrollment record, without a revocation list
+// nothing is revoked, and without TSARoots no timestamp is trusted to show
+// that a revoked key signed before its revocation.
+type Service struct {
+	Store       store.EnrollmentStore
+	Revocations string
+	TSARoots    *x509.CertPool
+}
+
+// EnrollRequest enrolls one capture: a fingerprint image (.jpg or .png), a raw
+// template, or a hex template, as named by Source.
+type EnrollRequest struct {
+	Subject      string
+	Source       string
+	Minutiae     int
+	Length       int
+	Aligned      bool
+	HammingError int
+	Robust       bool
+	KeyContext   string
+	Algorithm    string
+	Password     []byte
+	Recipient    []byte
+	Capture      []byte
+
+	// Progress, when set, is told the stage the enrollment is at and, while
+	// lockers are made, how many of them are done.
+	Progress func(stage string, done, total int)
+}
+
+// ReproduceRequest reproduces a key from a fresh capture, under Enrollment or
+// else the last enrollment of Subject in the store, and derives its signer.
+type ReproduceRequest struct {
+	Subject    string
+	Enrollment *lib.Enrollment
+	Credential lib.Credential
+	Capture    []byte
+	Algorithm  string
+}
+
+// SignRequest signs a document with the reproduced key.
+type SignRequest struct {
+	ReproduceRequest
+	Digest      string
+	Filename    string
+	ContentType string
+	Document    io.Reader
+}
+
+// VerifyRequest checks a bundle over a document, and that it was made by
+// PublicKey when given.
+type VerifyRequest struct {
+	Bundle    *lib.SignatureBundle
+	PublicKey []byte
+	Document  io.Reader
+}
+
+// VerifyResult describes a valid signature. Timestamp is the time attested
+// by its timestamp token, when one was issued by an authority of TSARoots.
+type VerifyResult struct {
+	Algorithm  string          `json:"algorithm"`
+	PublicKey  []byte          `json:"publicKey"`
+	Attributes *lib.Attributes `json:"attributes,omitempty"`
+	Timestamp  *time.Time      `json:"timestamp,omitempty"`
+}
+
+// Enroll enrolls a capture, storing the record under the subject when one is
+// given and the service has a store.
+func (s *Service) Enroll(req EnrollRequest) (*lib.Enrollment, error) {
+	e := &lib.Enrollment{
+		Source:       req.Source,
+		Length:       req.Length,
+		Aligned:      req.Aligned,
+		HammingError: req.HammingError,
+		Robust:       req.Robust,
+	}
+	if e.Source == "" {
+		e.Source = DefaultSource
+	}
+	if e.HammingError == 0 {
+		e.HammingError = DefaultHammingError
+	}
+	// Fingerprints pack every detected minutia unless a count is given
+	allMinutiae := e.Source == "fingerprint" && req.Minutiae == lib.DefaultMinutiae
+	if e.Source == "fingerprint" {
+		e.Minutiae = req.Minutiae
+		e.Length = e.Minutiae * 4
+	}
+	if !allMinutiae && (e.Length <= 0 || e.Length%4 != 0) {
+		return nil, fail(KindInvalid, errors.New("length must be a positive multiple of 4"))
+	}
+	if req.Subject != "" && s.Store == nil {
+		return nil, fail(KindInvalid, errors.New("no enrollment store to keep the subject in"))
+	}
+	if len(req.Password) > 0 && len(req.Recipient) > 0 {
+		return nil, fail(KindInvalid, errors.New("seal with a password or to a recipient, not both"))
+	}
+
+	progress := req.Progress
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+
+	progress(StageFeatures, 0, 0)
+	features, err := captureFeatures(e, req.Capture)
+	if err != nil {
+		return nil, err
+	}
+	if allMinutiae {
+		e.Minutiae, e.Length = len(features)/4, len(features)
+	}
+	fe := e.Extractor()
+	if p, ok := fe.(lib.ProgressExtractor); ok {
+		p.SetProgress(func(done, total int) {
+			progress(StageLockers, done, total)
+		})
+	}
+	key, helpers, err := fe.Gen(hex.EncodeToString(features))
+	if err != nil {
+		return nil, fail(KindInvalid, err)
+	}
+	if e.Helpers, err = helpers.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	e.ID = lib.NewEnrollmentID()
+	e.Salt = lib.NewKeySalt()
+	e.Keys = lib.DefaultKeyLabels(req.KeyContext)
+	signer, err := e.Signer(key, req.Algorithm)
+	if err != nil {
+		return nil, fail(KindInvalid, err)
+	}
+	e.Algorithm, e.PublicKey = signer.Algorithm(), signer.PublicKey()
+
+	if len(req.Password) > 0 || len(req.Recipient) > 0 {
+		progress(StageSealing, 0, 0)
+		if len(req.Password) > 0 {
+			e.Helpers, err = lib.SealPassword(e.Helpers, req.Password)
+		} else {
+			e.Helpers, err = lib.SealRecipient(e.Helpers, req.Recipient)
+		}
+		if err != nil {
+			return nil, fail(KindInvalid, err)
+		}
+	}
+
+	if req.Subject != "" {
+		if err := s.Store.Put(req.Subject, e); err != nil {
+			return nil, fail(KindInvalid, err)
+		}
+	}
+	return e, nil
+}
+
+// Reproduce reproduces the key of a single finger enrollment from a capture
+// and returns the signer derived from it, with the enrollment.
+func (s *Service) Reproduce(req ReproduceRequest) (lib.Signer, *lib.Enrollment, error) {
+	e := req.Enrollment
+	if e == nil {
+		if req.Subject == "" || s.Store == nil {
+			return nil, nil, fail(KindInvalid, errors.New("an enrollment or a stored subject is required"))
+		}
+		var err error
+		if e, err = s.Store.Get(req.Subject, ""); err != nil {
+			return nil, nil, fail(KindOf(err), err)
+		}
+	}
+	if e.Fingers != 0 {
+		return nil, nil, fail(KindInvalid, errors.New("enrollments of several fingers are reproduced with the CLI"))
+	}
+	if e.Length <= 0 || e.Length%4 != 0 {
+		return nil, nil, fail(KindInvalid, errors.New("enrollment has an invalid length"))
+	}
+
+	revocations, err := s.revocations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := refuseRevoked(revocations, e.ID, e.PublicKey); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := e.OpenHelpers(req.Credential)
+	if err != nil {
+		return nil, nil, fail(KindNoMatch, err)
+	}
+	helpers := &lib.Helpers[uint32]{}
+	if err := helpers.UnmarshalBinary(data); err != nil {
+		return nil, nil, fail(KindInvalid, err)
+	}
+
+	features, err := captureFeatures(e, req.Capture)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := e.Extractor().Rep(hex.EncodeToString(features), helpers)
+	if err != nil {
+		return nil, nil, fail(KindNoMatch, err)
+	}
+
+	signer, err := e.Signer(key, req.Algorithm)
+	if err != nil {
+		return nil, nil, fail(KindInvalid, err)
+	}
+	if err := refuseRevoked(revocations, e.ID, signer.PublicKey()); err != nil {
+		return nil, nil, err
+	}
+	return signer, e, nil
+}
+
+// refuseRevoked fails when the enrollment or the key it signs with is in the
+// revocation list.
+func refuseRevoked(l *lib.RevocationList, id string, pub []byte) error {
+	r := l.Lookup(id)
+	if r == nil {
+		r = l.LookupKey(pub)
+	}
+	if r != nil {
+		return fail(KindRevoked, errors.New("enrollment "+r.ID+" was revoked at "+r.RevokedAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// Sign reproduces the key of an enrollment and signs a document with it.
+func (s *Service) Sign(req SignRequest) (*lib.SignatureBundle, error) {
+	signer, e, err := s.Reproduce(req.ReproduceRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := req.Digest
+	if digest == "" {
+		digest = lib.DigestSHA256
+	}
+	content := bufio.NewReader(req.Document)
+	contentType := req.ContentType
+	if contentType == "" {
+		head, _ := content.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	attrs := &lib.Attributes{
+		SigningTime: time.Now().UTC(),
+		SignerID:    lib.KeyID(signer.PublicKey()),
+		ContentType: contentType,
+		Filename:    req.Filename,
+		Version:     lib.Version(),
+		ParamsHash:  e.ParamsHash(),
+	}
+
+	sb, err := lib.SignReaderWithAttributes(signer, digest, content, attrs)
+	if err != nil {
+		return nil, fail(KindInvalid, err)
+	}
+	return sb, nil
+}
+
+// Verify checks a signature bundle over a document, its timestamp if any, and
+// that its key was not revoked before the timestamp.
+func (s *Service) Verify(req VerifyRequest) (*VerifyResult, error) {
+	sb := req.Bundle
+	if sb == nil {
+		return nil, fail(KindInvalid, errors.New("a signature bundle is required"))
+	}
+	if err := sb.VerifyReader(req.Document); err != nil {
+		return nil, fail(KindBadSignature, err)
+	}
+	if req.PublicKey != nil && !bytes.Equal(req.PublicKey, sb.PublicKey) {
+		return nil, fail(KindBadSignature, errors.New("signed by another key"))
+	}
+
+	// Tokens of other authorities may be self-issued, so they are checked but
+	// vouch for no time
+	result := &VerifyResult{Algorithm: sb.Algorithm, PublicKey: sb.PublicKey, Attributes: sb.Attributes}
+	if sb.Timestamp != nil {
+		info, err := tsa.Verify(sb.Timestamp, sb.Signature)
+		if err != nil {
+			return nil, fail(KindBadSignature, err)
+		}
+		if s.TSARoots != nil && info.Trusted(s.TSARoots) == nil {
+			result.Timestamp = &info.Time
+		}
+	}
+
+	revocations, err := s.revocations()
+	if err != nil {
+		return nil, err
+	}
+	if r := revocations.LookupKey(sb.PublicKey); r != nil {
+		if result.Timestamp == nil || !result.Timestamp.Before(r.RevokedAt) {
+			return nil, fail(KindRevoked, errors.New("signed by revoked enrollment "+r.ID))
+		}
+	}
+	return result, nil
+}
+
+// revocations reads the revocation list, which may change while serving. A
+// list not written yet revokes nothing.
+func (s *Service) revocations() (*lib.RevocationList, error) {
+	if s.Revocations == "" {
+		return &lib.RevocationList{}, nil
+	}
+	l, err := lib.LoadRevocations(s.Revocations)
+	if errors.Is(err, os.ErrNotExist) {
+		return &lib.RevocationList{}, nil
+	}
+	return l, err
+}
+
+// captureFeatures reads the features of a capture for the source of e.
+func captureFeatures(e *lib.Enrollment, capture []byte) ([]byte, error) {
+	if len(capture) == 0 {
+		return nil, fail(KindInvalid, errors.New("a capture is required"))
+	}
+
+	var source lib.FeatureSource
+	switch e.Source {
+	case "fingerprint":
+		// The image library exits on images it cannot decode, so decode
+		// them here first
+		config, format, err := image.DecodeConfig(bytes.NewReader(capture))
+		if err != nil {
+			return nil, fail(KindInvalid, err)
+		}
+		if config.Width*config.Height > maxPixels {
+			return nil, fail(KindInvalid, errors.New("fingerprint image too large"))
+		}
+		if _, _, err := image.Decode(bytes.NewReader(capture)); err != nil {
+			return nil, fail(KindInvalid, err)
+		}
+
+		ext := map[string]string{"jpeg": ".jpg", "png": ".png"}[format]
+		f, err := os.CreateTemp("", "gofze-capture-*"+ext)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(capture)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Aligned {
+			source = lib.NewAlignedFingerprintSource(f.Name(), e.Minutiae)
+		} else {
+			source = lib.NewFingerprintSource(f.Name(), e.Minutiae)
+		}
+	case "template":
+		if len(capture) != e.Length {
+			return nil, fail(KindInvalid, errors.New("invalid template length"))
+		}
+		return capture, nil
+	case "hex":
+		source = lib.NewHexSource(bytes.NewReader(capture), e.Length)
+	default:
+		return nil, fail(KindInvalid, errors.New("unknown biometric source: "+e.Source))
+	}
+
+	features, err := source.Features()
+	if err != nil {
+		return nil, fail(KindInvalid, err)
+	}
+	return features, nil
+}
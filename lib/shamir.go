@@ -0,0 +1,103 @@
+package lib
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Shamir secret sharing over GF(2^8) with the AES polynomial. Every share is
+// its x coordinate followed by one y coordinate per secret byte.
+
+// SplitSecret splits secret into n shares, any `threshold` of which recover it.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 1 || threshold > n || n > 255 {
+		return nil, errors.New("gofze/lib/shamir.go: invalid threshold")
+	}
+
+	if len(secret) == 0 {
+		return nil, errors.New("gofze/lib/shamir.go: empty secret")
+	}
+
+	shares := make([][]byte, n)
+	for i := range n {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for j, s := range secret {
+		coefficients[0] = s
+		rand.Read(coefficients[1:])
+		for i := range n {
+			x := shares[i][0]
+			y := byte(0)
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, x) ^ coefficients[k]
+			}
+			shares[i][j+1] = y
+		}
+	}
+	clear(coefficients)
+
+	return shares, nil
+}
+
+// CombineShares recovers the secret from at least threshold distinct shares
+// by Lagrange interpolation at x = 0. Fewer shares give an unrelated value.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("gofze/lib/shamir.go: no shares")
+	}
+
+	length := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) != length || length < 2 {
+			return nil, errors.New("gofze/lib/shamir.go: shares differ in length")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("gofze/lib/shamir.go: duplicate or invalid share")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		// Lagrange basis polynomial of share i evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+			}
+		}
+		for k := range secret {
+			secret[k] ^= gfMul(basis, share[k+1])
+		}
+	}
+	return secret, nil
+}
+
+func gfMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 == 1 {
+			p ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// gfDiv divides by b != 0 using b^254 = b^-1.
+func gfDiv(a, b byte) byte {
+	inverse := byte(1)
+	for range 254 {
+		inverse = gfMul(inverse, b)
+	}
+	return gfMul(a, inverse)
+}
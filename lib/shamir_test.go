@@ -0,0 +1,41 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestShamir(t *testing.T) {
+	secret := []byte("gofze threshold secret")
+
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		picked := [][]byte{}
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+
+		recovered, err := CombineShares(picked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(recovered, secret) {
+			t.Errorf("Shares %v do not recover the secret", subset)
+		}
+	}
+
+	recovered, _ := CombineShares(shares[:2])
+	if bytes.Equal(recovered, secret) {
+		t.Error("Two shares recovered a threshold 3 secret")
+	}
+
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Expected duplicate shares to be rejected")
+	}
+}
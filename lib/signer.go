@@ -0,0 +1,264 @@
+package lib
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/nart4hire/goschnorr"
+)
+
+// Signature algorithms. Schnorr is the finite field scheme of goschnorr over
+// the fixed group of schnorrP, and BIP340 is the standard Schnorr scheme over
+// secp256k1.
+const (
+	AlgSchnorr   = "schnorr"
+	AlgEd25519   = "ed25519"
+	AlgECDSAP256 = "ecdsa-p256"
+	AlgBIP340    = "bip340"
+)
+
+// Signer signs messages under a key derived from the biometric key.
+type Signer interface {
+	Algorithm() string
+	PublicKey() []byte
+	Sign(message []byte) ([]byte, error)
+}
+
+// CryptoSigner is implemented by the signers backed by a standard library key,
+// for formats such as CMS that embed the key in an X.509 certificate.
+type CryptoSigner interface {
+	Signer
+	Crypto() crypto.Signer
+}
+
+// NewSigner builds the signer of alg from a derived signing key, such as the
+// PurposeSign key of an Enrollment. The same key always gives the same public
+// key.
+func NewSigner(alg string, key []byte) (Signer, error) {
+	switch alg {
+	case AlgSchnorr:
+		return newSchnorrSigner(key)
+	case AlgEd25519:
+		if len(key) != ed25519.SeedSize {
+			return nil, errors.New("gofze/lib/signer.go: ed25519 needs a 32 byte key")
+		}
+		return &ed25519signer{ed25519.NewKeyFromSeed(key)}, nil
+	case AlgECDSAP256:
+		return newECDSASigner(key)
+	case AlgBIP340:
+		return newBIP340Signer(key)
+	}
+	return nil, errors.New("gofze/lib/signer.go: unknown algorithm " + alg)
+}
+
+// Verify checks a signature made by the signer of alg.
+func Verify(alg string, publicKey, message, signature []byte) error {
+	switch alg {
+	case AlgSchnorr:
+		return verifySchnorr(publicKey, message, signature)
+	case AlgEd25519:
+		if len(publicKey) != ed25519.PublicKeySize || !ed25519.Verify(publicKey, message, signature) {
+			return errors.New("gofze/lib/signer.go: invalid signature")
+		}
+		return nil
+	case AlgECDSAP256:
+		return verifyECDSA(publicKey, message, signature)
+	case AlgBIP340:
+		digest := sha256.Sum256(message)
+		return VerifyBIP340(publicKey, digest[:], signature)
+	}
+	return errors.New("gofze/lib/signer.go: unknown algorithm " + alg)
+}
+
+type ed25519signer struct {
+	priv ed25519.PrivateKey
+}
+
+func (s *ed25519signer) Algorithm() string { return AlgEd25519 }
+
+func (s *ed25519signer) PublicKey() []byte {
+	return s.priv.Public().(ed25519.PublicKey)
+}
+
+func (s *ed25519signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.priv, message), nil
+}
+
+func (s *ed25519signer) Crypto() crypto.Signer { return s.priv }
+
+// ecdsasigner signs SHA-256 digests with RFC 6979 deterministic nonces, so no
+// signature depends on the quality of the system randomness.
+type ecdsasigner struct {
+	priv *ecdsa.PrivateKey
+	pub  []byte // Uncompressed point
+}
+
+func newECDSASigner(key []byte) (Signer, error) {
+	if len(key) < 32 {
+		return nil, errors.New("gofze/lib/signer.go: ecdsa needs a 32 byte key")
+	}
+
+	// Map the key onto [1, n-1]
+	n := elliptic.P256().Params().N
+	d := new(big.Int).SetBytes(key)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	priv, err := ecdh.P256().NewPrivateKey(d.FillBytes(make([]byte, 32)))
+	if err != nil {
+		return nil, err
+	}
+	pub := priv.PublicKey().Bytes()
+
+	return &ecdsasigner{
+		priv: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(pub[1:33]),
+				Y:     new(big.Int).SetBytes(pub[33:]),
+			},
+			D: d,
+		},
+		pub: pub,
+	}, nil
+}
+
+func (s *ecdsasigner) Algorithm() string { return AlgECDSAP256 }
+
+func (s *ecdsasigner) PublicKey() []byte { return s.pub }
+
+func (s *ecdsasigner) Crypto() crypto.Signer { return s.priv }
+
+func (s *ecdsasigner) Sign(message []byte) ([]byte, error) {
+	digest := sha256.Sum256(message)
+	return s.priv.Sign(nil, digest[:], crypto.SHA256)
+}
+
+func verifyECDSA(publicKey, message, signature []byte) error {
+	// Rejects points that are malformed or not on the curve
+	if _, err := ecdh.P256().NewPublicKey(publicKey); err != nil {
+		return err
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(publicKey[1:33]),
+		Y:     new(big.Int).SetBytes(publicKey[33:]),
+	}
+	digest := sha256.Sum256(message)
+	if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+		return errors.New("gofze/lib/signer.go: invalid signature")
+	}
+	return nil
+}
+
+// schnorrP is the 2048-bit MODP group of RFC 3526, a safe prime p = 2q + 1
+// in which 2 generates the subgroup of prime order q. Every Schnorr key lives
+// in this published group, so public keys are the element y alone and no
+// group parameters are taken from a signature.
+var (
+	schnorrP, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+	schnorrQ    = new(big.Int).Rsh(schnorrP, 1)
+	schnorrG    = big.NewInt(2)
+)
+
+// schnorrKeyLength is the size of a Schnorr public key, the element y.
+const schnorrKeyLength = 256
+
+// schnorrsigner holds x with the public key y = g^-x, as goschnorr does, and
+// signs as the length prefixed fields s | e.
+type schnorrsigner struct {
+	priv *big.Int
+	pub  []byte
+}
+
+func newSchnorrSigner(key []byte) (Signer, error) {
+	// The private key must be in [1, q-1]
+	priv := new(big.Int).Mod(new(big.Int).SetBytes(key), schnorrQ)
+	if priv.Sign() == 0 {
+		return nil, errors.New("gofze/lib/signer.go: invalid schnorr key")
+	}
+
+	y, err := schnorr.NewSchnorrFromParam(schnorrP, schnorrQ, schnorrG, rand.Reader, sha256.New()).GenFromPriv(priv.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	pub := new(big.Int).SetBytes(y).FillBytes(make([]byte, schnorrKeyLength))
+	return &schnorrsigner{priv: priv, pub: pub}, nil
+}
+
+func (s *schnorrsigner) Algorithm() string { return AlgSchnorr }
+
+func (s *schnorrsigner) PublicKey() []byte { return s.pub }
+
+// Sign computes e = H(r | message) with r = g^k as goschnorr does, but draws
+// k uniformly below q and reduces s = k + xe mod q, so s reveals nothing of x.
+func (s *schnorrsigner) Sign(message []byte) ([]byte, error) {
+	k, err := rand.Int(rand.Reader, new(big.Int).Sub(schnorrQ, big.NewInt(1)))
+	if err != nil {
+		return nil, err
+	}
+	k.Add(k, big.NewInt(1))
+	r := new(big.Int).Exp(schnorrG, k, schnorrP)
+
+	h := sha256.New()
+	h.Write(r.Bytes())
+	h.Write(message)
+	e := h.Sum(nil)
+
+	sig := new(big.Int).Mul(s.priv, new(big.Int).SetBytes(e))
+	sig.Add(sig, k).Mod(sig, schnorrQ)
+	return appendField(appendField([]byte{}, sig.Bytes()), e), nil
+}
+
+func verifySchnorr(publicKey, message, signature []byte) error {
+	// The key must be an element of the subgroup of order q
+	y := new(big.Int).SetBytes(publicKey)
+	if len(publicKey) != schnorrKeyLength || y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(schnorrP) >= 0 ||
+		new(big.Int).Exp(y, schnorrQ, schnorrP).Cmp(big.NewInt(1)) != 0 {
+		return errors.New("gofze/lib/signer.go: invalid schnorr public key")
+	}
+	sig, err := readFields(signature, 2)
+	if err != nil {
+		return err
+	}
+	if new(big.Int).SetBytes(sig[0]).Cmp(schnorrQ) >= 0 || len(sig[1]) != sha256.Size {
+		return errors.New("gofze/lib/signer.go: invalid signature")
+	}
+
+	s := schnorr.NewSchnorrFromParam(schnorrP, schnorrQ, schnorrG, rand.Reader, sha256.New())
+	if !s.Verify(publicKey, sig[0], sig[1], string(message)) {
+		return errors.New("gofze/lib/signer.go: invalid signature")
+	}
+	return nil
+}
+
+func appendField(b, field []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(field)))
+	return append(b, field...)
+}
+
+// readFields splits exactly count length prefixed fields.
+func readFields(b []byte, count int) ([][]byte, error) {
+	fields := make([][]byte, count)
+	for i := range fields {
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			return nil, errors.New("gofze/lib/signer.go: truncated field")
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		fields[i], b = b[2:2+n], b[2+n:]
+	}
+
+	if len(b) != 0 {
+		return nil, errors.New("gofze/lib/signer.go: trailing field data")
+	}
+	return fields, nil
+}
@@ -0,0 +1,109 @@
+package lib_test
+
+import (
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestSigners(t *testing.T) {
+	key, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	message := []byte("gofze signed message")
+
+	for _, alg := range []string{AlgSchnorr, AlgEd25519, AlgECDSAP256, AlgBIP340} {
+		s, err := NewSigner(alg, key)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+
+		sb, err := SignBundle(s, message)
+		if err != nil {
+			t.Fatalf("%s: %v", alg, err)
+		}
+		if sb.Algorithm != alg {
+			t.Errorf("%s: bundle records %s", alg, sb.Algorithm)
+		}
+
+		path := filepath.Join(t.TempDir(), "signature.json")
+		if err := SaveSignature(path, sb); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadSignature(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := loaded.Verify(message); err != nil {
+			t.Errorf("%s: %v", alg, err)
+		}
+		if err := loaded.Verify([]byte("another message")); err == nil {
+			t.Errorf("%s: expected another message to be rejected", alg)
+		}
+	}
+
+	// Schnorr keys live in a fixed group, so a key has a single public key
+	first, _ := NewSigner(AlgSchnorr, key)
+	second, _ := NewSigner(AlgSchnorr, key)
+	if hex.EncodeToString(first.PublicKey()) != hex.EncodeToString(second.PublicKey()) {
+		t.Error("Expected the same schnorr public key for the same key")
+	}
+	// y = 1 verifies any e against r = g^s
+	forged := make([]byte, len(first.PublicKey()))
+	forged[len(forged)-1] = 1
+	if err := Verify(AlgSchnorr, forged, message, []byte{0, 1, 1, 0, 1, 0}); err == nil {
+		t.Error("Expected a key outside the group to be rejected")
+	}
+
+	if _, err := NewSigner("rsa", key); err == nil {
+		t.Error("Expected an unknown algorithm to be rejected")
+	}
+}
+
+func TestEd25519Signer(t *testing.T) {
+	// RFC 8032 section 7.1, test 1
+	key, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	s, err := NewSigner(AlgEd25519, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(s.PublicKey()) != "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a" {
+		t.Error("Public key does not match")
+	}
+}
+
+func TestECDSASignerRFC6979(t *testing.T) {
+	// RFC 6979 A.2.5, P-256 with SHA-256 over "sample". Keys are mapped onto
+	// [1, n-1] by adding one, so the vector's key is passed minus one.
+	x, _ := new(big.Int).SetString("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721", 16)
+	key := new(big.Int).Sub(x, big.NewInt(1)).FillBytes(make([]byte, 32))
+
+	s, err := NewSigner(AlgECDSAP256, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(s.PublicKey()[1:33]) != "60fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6" {
+		t.Error("Public key does not match")
+	}
+
+	sig, err := s.Sign([]byte("sample"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		t.Fatal(err)
+	}
+	if rs.R.Text(16) != "efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716" {
+		t.Error("r does not match")
+	}
+	if rs.S.Text(16) != "f7cb1c942d657c41d436c7a1b6e29f65f3e900dbb9aff4064dc4ab2f843acda8" {
+		t.Error("s does not match")
+	}
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/nart4hire/fingerprints/lib/extraction"
+	"github.com/nart4hire/fingerprints/lib/helpers"
+)
+
+// DefaultMinutiae packs every detected minutia of a fingerprint. A positive
+// count truncates or zero pads the minutiae to a fixed length instead.
+const DefaultMinutiae = 0
+
+// FeatureSource produces the biometric reading that is fed to a FuzzyExtractor.
+// Every vector returned by Features is exactly Length() bytes long, so sources
+// producing uint32 words (such as fingerprints) return them big endian encoded.
+type FeatureSource interface {
+	Features() ([]byte, error)
+	Length() int
+}
+
+type fingerprintsource struct {
+	path     string
+	minutiae int
+	aligned  bool
+	read     int
+}
+
+type templatesource struct {
+	path   string
+	length int
+}
+
+type hexsource struct {
+	reader io.Reader
+	length int
+	value  []byte
+}
+
+// NewFingerprintSource reads minutiae from a .jpg or .png fingerprint image.
+// The first `minutiae` detected minutiae are packed into uint32 words, and
+// missing ones are left as zero words to keep the vector length fixed. With
+// DefaultMinutiae every detected minutia is packed, and Length is that of the
+// last reading.
+func NewFingerprintSource(path string, minutiae int) FeatureSource {
+	return &fingerprintsource{
+		path:     path,
+		minutiae: minutiae,
+	}
+}
+
+// NewAlignedFingerprintSource is like NewFingerprintSource, but moves minutiae
+// into the coordinates of the detected fingerprint frame and packs them in
+// raster order, so separate captures of one finger fill the same words with the
+// same minutiae. Multi-sample enrollment relies on this alignment.
+func NewAlignedFingerprintSource(path string, minutiae int) FeatureSource {
+	return &fingerprintsource{
+		path:     path,
+		minutiae: minutiae,
+		aligned:  true,
+	}
+}
+
+// NewTemplateSource reads a precomputed raw template of `length` bytes.
+func NewTemplateSource(path string, length int) FeatureSource {
+	return &templatesource{
+		path:   path,
+		length: length,
+	}
+}
+
+// NewHexSource reads a hex encoded template of `length` bytes, such as stdin.
+// The reader is consumed once and the value is reused on later calls.
+func NewHexSource(reader io.Reader, length int) FeatureSource {
+	return &hexsource{
+		reader: reader,
+		length: length,
+	}
+}
+
+func (s *fingerprintsource) Features() ([]byte, error) {
+	if s.minutiae < 0 {
+		return nil, errors.New("gofze/lib/source.go: invalid minutiae count")
+	}
+
+	// LoadImage exits the process on failure, so reject what it cannot open.
+	ext := path.Ext(s.path)
+	if ext != ".jpg" && ext != ".png" {
+		return nil, errors.New("gofze/lib/source.go: unsupported image format")
+	}
+	if _, err := os.Stat(s.path); err != nil {
+		return nil, err
+	}
+
+	_, m := helpers.LoadImage(s.path)
+	minutiae := extraction.DetectionResult(m)
+	if len(minutiae.Minutia) == 0 {
+		return nil, errors.New("gofze/lib/source.go: no minutiae detected")
+	}
+
+	list := minutiae.Minutia
+	if s.aligned {
+		list = minutiae.RelativeMinutia()
+		for i := range list {
+			list[i].Angle = math.Mod(list[i].Angle, 2*math.Pi)
+			if list[i].Angle < 0 {
+				list[i].Angle += 2 * math.Pi
+			}
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Y != list[j].Y {
+				return list[i].Y < list[j].Y
+			}
+			return list[i].X < list[j].X
+		})
+	}
+
+	count := s.minutiae
+	if count == DefaultMinutiae {
+		count = len(list)
+	}
+	s.read = count * 4
+
+	features := make([]byte, s.read)
+	for i := range min(count, len(list)) {
+		minutia := NewMinutia(&list[i])
+		binary.BigEndian.PutUint32(features[i*4:], minutia.GetBuffer())
+	}
+	return features, nil
+}
+
+func (s *fingerprintsource) Length() int {
+	if s.minutiae == DefaultMinutiae {
+		return s.read
+	}
+	return s.minutiae * 4
+}
+
+func (s *templatesource) Features() ([]byte, error) {
+	features, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(features) != s.length {
+		return nil, errors.New("gofze/lib/source.go: invalid template length")
+	}
+	return features, nil
+}
+
+func (s *templatesource) Length() int {
+	return s.length
+}
+
+func (s *hexsource) Features() ([]byte, error) {
+	if s.value == nil {
+		b, err := io.ReadAll(s.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := hex.DecodeString(string(bytes.TrimSpace(b)))
+		if err != nil {
+			return nil, err
+		}
+		s.value = value
+	}
+
+	if len(s.value) != s.length {
+		return nil, errors.New("gofze/lib/source.go: invalid template length")
+	}
+	return bytes.Clone(s.value), nil
+}
+
+func (s *hexsource) Length() int {
+	return s.length
+}
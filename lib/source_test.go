@@ -0,0 +1,99 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestFingerprintSource(t *testing.T) {
+	src := NewFingerprintSource("../tc/103_6.jpg", 8)
+
+	features, err := src.Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(features) != src.Length() || src.Length() != 32 {
+		t.Error("Fingerprint features have the wrong length")
+	}
+
+	aligned, err := NewAlignedFingerprintSource("../tc/103_6.jpg", 8).Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(aligned) != 32 {
+		t.Error("Aligned fingerprint features have the wrong length")
+	}
+
+	// By default every detected minutia is packed
+	all := NewFingerprintSource("../tc/103_6.jpg", DefaultMinutiae)
+	packed, err := all.Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) != all.Length() || len(packed) <= 32 || !bytes.Equal(packed[:32], features) {
+		t.Error("Not every minutia was packed")
+	}
+
+	if _, err := NewFingerprintSource("../tc/test.pdf", 8).Features(); err == nil {
+		t.Error("Expected unsupported image format")
+	}
+}
+
+func TestTemplateSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.bin")
+	value, _ := hex.DecodeString("00112233445566778899aabbccddeeff")
+	if err := os.WriteFile(path, value, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	features, err := NewTemplateSource(path, 16).Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(features) != "00112233445566778899aabbccddeeff" {
+		t.Error("Template features do not match")
+	}
+
+	if _, err := NewTemplateSource(path, 32).Features(); err == nil {
+		t.Error("Expected invalid template length")
+	}
+}
+
+func TestHexSource(t *testing.T) {
+	src := NewHexSource(strings.NewReader("00112233445566778899aabbccddeeff\n"), 16)
+
+	features, err := src.Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fe := NewDefaultFuzzy32Extractor(src.Length()/4, 2)
+	key, helpers, err := fe.Gen(hex.EncodeToString(features))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader is consumed, so the second reading comes from the cache
+	again, err := src.Features()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := fe.Rep(hex.EncodeToString(again), helpers)
+	if err != nil {
+		t.Error("Failed to reproduce key")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// boltTimeout bounds the wait for another process holding the database.
+const boltTimeout = 5 * time.Second
+
+type boltstore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore returns a store in a single BoltDB file, with a bucket per
+// subject keyed by enrollment ID. Every operation is a transaction, and the
+// database is locked by the process that opened it until Close.
+func NewBoltStore(path string) (EnrollmentStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &boltstore{db: db}, nil
+}
+
+func (s *boltstore) Put(subject string, e *lib.Enrollment) error {
+	if err := checkPut(subject, e); err != nil {
+		return err
+	}
+	v, err := marshalRecord(e)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(subject))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(e.ID), v)
+	})
+}
+
+func (s *boltstore) Get(subject, id string) (*lib.Enrollment, error) {
+	if err := checkSubject(subject); err != nil {
+		return nil, err
+	}
+	if id != "" {
+		if err := checkID(id); err != nil {
+			return nil, err
+		}
+	}
+
+	var e *lib.Enrollment
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(subject))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		if id == "" {
+			entries, err := list(subject, bucket)
+			if err != nil {
+				return err
+			}
+			if id, err = latest(entries); err != nil {
+				return err
+			}
+		}
+
+		v := bucket.Get([]byte(id))
+		if v == nil {
+			return ErrNotFound
+		}
+		var err error
+		e, _, err = read(v)
+		return err
+	})
+	return e, err
+}
+
+func (s *boltstore) List(subject string) ([]Entry, error) {
+	if subject != "" {
+		if err := checkSubject(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := []Entry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			if subject != "" && string(name) != subject {
+				return nil
+			}
+			list, err := list(string(name), bucket)
+			entries = append(entries, list...)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// list describes the records in the bucket of a subject.
+func list(subject string, bucket *bolt.Bucket) ([]Entry, error) {
+	entries := []Entry{}
+	err := bucket.ForEach(func(_, v []byte) error {
+		e, stored, err := read(v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry(subject, e, stored))
+		return nil
+	})
+	return entries, err
+}
+
+func (s *boltstore) Delete(subject, id string) error {
+	if err := checkSubject(subject); err != nil {
+		return err
+	}
+	if id != "" {
+		if err := checkID(id); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(subject))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		if id == "" {
+			return tx.DeleteBucket([]byte(subject))
+		}
+
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		// Drop the subject with its last record
+		if k, _ := bucket.Cursor().First(); k == nil {
+			return tx.DeleteBucket([]byte(subject))
+		}
+		return nil
+	})
+}
+
+func (s *boltstore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// lockName is the file locked by every operation of a file store.
+const lockName = ".lock"
+
+// recordSuffix ends the name of every record of a file store.
+const recordSuffix = ".json"
+
+type filestore struct {
+	root string
+}
+
+// NewFileStore returns a store keeping every subject in a directory of root,
+// holding one <id>.json record per enrollment with the time it was stored.
+// Plain enrollments written by SaveEnrollment are read too, as stored at
+// their modification time. Records are replaced atomically, and operations
+// take a shared or exclusive lock on root/.lock, so several processes can use
+// the store at once.
+func NewFileStore(root string) (EnrollmentStore, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &filestore{root: root}, nil
+}
+
+// lock locks the store, exclusively to modify it, and returns the unlock.
+func (s *filestore) lock(exclusive bool) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.root, lockName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+func (s *filestore) path(subject, id string) string {
+	return filepath.Join(s.root, subject, id+recordSuffix)
+}
+
+func (s *filestore) Put(subject string, e *lib.Enrollment) error {
+	if err := checkPut(subject, e); err != nil {
+		return err
+	}
+	b, err := marshalRecord(e)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(s.root, subject)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	return writeAtomic(dir, s.path(subject, e.ID), b)
+}
+
+// writeAtomic writes a file next to path and renames it into place, so
+// readers see the old or the new record but never part of one.
+func writeAtomic(dir, path string, b []byte) error {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename where directories can be synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+func (s *filestore) Get(subject, id string) (*lib.Enrollment, error) {
+	if err := checkSubject(subject); err != nil {
+		return nil, err
+	}
+	if id != "" {
+		if err := checkID(id); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if id == "" {
+		entries, err := s.list(subject)
+		if err != nil {
+			return nil, err
+		}
+		if id, err = latest(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	e, _, err := readFile(s.path(subject, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return e, err
+}
+
+// readFile decodes a record file, or a plain enrollment stored at the time
+// the file was last modified.
+func readFile(path string) (*lib.Enrollment, time.Time, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	r := record{}
+	if err := json.Unmarshal(b, &r); err == nil && r.Enrollment != nil {
+		return read(b)
+	}
+
+	e, err := lib.ParseEnrollment(b)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return e, info.ModTime(), nil
+}
+
+func (s *filestore) List(subject string) ([]Entry, error) {
+	if subject != "" {
+		if err := checkSubject(subject); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	subjects := []string{subject}
+	if subject == "" {
+		dirs, err := os.ReadDir(s.root)
+		if err != nil {
+			return nil, err
+		}
+		subjects = subjects[:0]
+		for _, d := range dirs {
+			if d.IsDir() && checkSubject(d.Name()) == nil {
+				subjects = append(subjects, d.Name())
+			}
+		}
+	}
+
+	entries := []Entry{}
+	for _, subject := range subjects {
+		list, err := s.list(subject)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, list...)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// list describes the records of one subject; the store must be locked.
+func (s *filestore) list(subject string) ([]Entry, error) {
+	files, err := os.ReadDir(filepath.Join(s.root, subject))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), recordSuffix)
+		if !ok || !f.Type().IsRegular() || checkID(id) != nil {
+			continue
+		}
+		e, stored, err := readFile(filepath.Join(s.root, subject, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry(subject, e, stored))
+	}
+	return entries, nil
+}
+
+func (s *filestore) Delete(subject, id string) error {
+	if err := checkSubject(subject); err != nil {
+		return err
+	}
+	if id != "" {
+		if err := checkID(id); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(s.root, subject)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if id == "" {
+		return os.RemoveAll(dir)
+	}
+
+	if err := os.Remove(s.path(subject, id)); errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	// Drop the subject with its last record, failing harmlessly otherwise
+	os.Remove(dir)
+	return nil
+}
+
+func (s *filestore) Close() error {
+	return nil
+}
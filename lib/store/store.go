@@ -0,0 +1,147 @@
+// Package store keeps enrollment records by subject, the user or device they
+// were enrolled for, so applications need not track record files themselves.
+// A subject may hold several enrollments, e.g. the ones left by rotation, each
+// named by its ID. Records are stored as they are, so sealed helpers stay
+// sealed at rest.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+)
+
+// Backends accepted by Open.
+const (
+	BackendFile = "file"
+	BackendBolt = "bolt"
+)
+
+// ErrNotFound is returned for subjects and enrollments that are not stored.
+var ErrNotFound = errors.New("gofze/lib/store/store.go: enrollment not found")
+
+// Entry describes a stored enrollment.
+type Entry struct {
+	Subject   string    `json:"subject"`
+	ID        string    `json:"id"`
+	Algorithm string    `json:"algorithm,omitempty"`
+	PublicKey []byte    `json:"publicKey,omitempty"`
+	Stored    time.Time `json:"stored"`
+}
+
+// EnrollmentStore holds the enrollment records of many subjects.
+type EnrollmentStore interface {
+	// Put stores e under its ID, replacing a record with the same ID.
+	Put(subject string, e *lib.Enrollment) error
+	// Get returns the enrollment of a subject with the given ID, or the one
+	// stored last when id is empty.
+	Get(subject, id string) (*lib.Enrollment, error)
+	// List describes the enrollments of a subject, or of every subject when
+	// subject is empty, by subject and then in the order they were stored.
+	List(subject string) ([]Entry, error)
+	// Delete removes the enrollment of a subject with the given ID, or the
+	// whole subject when id is empty.
+	Delete(subject, id string) error
+	Close() error
+}
+
+// Open opens the store of the given backend at path, creating it if needed:
+// a directory for BackendFile and a database file for BackendBolt.
+func Open(backend, path string) (EnrollmentStore, error) {
+	switch backend {
+	case BackendFile:
+		return NewFileStore(path)
+	case BackendBolt:
+		return NewBoltStore(path)
+	}
+	return nil, errors.New("gofze/lib/store/store.go: unknown backend " + backend)
+}
+
+var (
+	subjectPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@+-]{0,127}$`)
+	idPattern      = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+)
+
+// checkSubject rejects subjects that are not safe as a file name.
+func checkSubject(subject string) error {
+	if !subjectPattern.MatchString(subject) {
+		return errors.New("gofze/lib/store/store.go: invalid subject " + subject)
+	}
+	return nil
+}
+
+// checkID rejects enrollment IDs not made by lib.NewEnrollmentID.
+func checkID(id string) error {
+	if !idPattern.MatchString(id) {
+		return errors.New("gofze/lib/store/store.go: invalid enrollment ID " + id)
+	}
+	return nil
+}
+
+// checkPut validates the arguments of Put.
+func checkPut(subject string, e *lib.Enrollment) error {
+	if err := checkSubject(subject); err != nil {
+		return err
+	}
+	if e.ID == "" {
+		return errors.New("gofze/lib/store/store.go: enrollment has no ID")
+	}
+	return checkID(e.ID)
+}
+
+// record is what both backends store for an enrollment, so they order the
+// records of a subject by the same time.
+type record struct {
+	Stored     time.Time       `json:"stored"`
+	Enrollment json.RawMessage `json:"enrollment"`
+}
+
+// marshalRecord encodes e as stored now.
+func marshalRecord(e *lib.Enrollment) ([]byte, error) {
+	b, err := lib.MarshalEnrollment(e)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record{Stored: time.Now().UTC(), Enrollment: b})
+}
+
+// read decodes a stored record.
+func read(v []byte) (*lib.Enrollment, time.Time, error) {
+	r := record{}
+	if err := json.Unmarshal(v, &r); err != nil {
+		return nil, time.Time{}, err
+	}
+	e, err := lib.ParseEnrollment(r.Enrollment)
+	return e, r.Stored, err
+}
+
+// entry describes e as stored under subject at the given time.
+func entry(subject string, e *lib.Enrollment, stored time.Time) Entry {
+	return Entry{Subject: subject, ID: e.ID, Algorithm: e.Algorithm, PublicKey: e.PublicKey, Stored: stored}
+}
+
+// sortEntries orders entries by subject and then by the time they were stored.
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Subject != entries[j].Subject {
+			return entries[i].Subject < entries[j].Subject
+		}
+		if !entries[i].Stored.Equal(entries[j].Stored) {
+			return entries[i].Stored.Before(entries[j].Stored)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+// latest returns the ID of the enrollment stored last.
+func latest(entries []Entry) (string, error) {
+	if len(entries) == 0 {
+		return "", ErrNotFound
+	}
+	sortEntries(entries)
+	return entries[len(entries)-1].ID, nil
+}
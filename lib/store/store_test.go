@@ -0,0 +1,175 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nart4hire/gofze/lib"
+	. "github.com/nart4hire/gofze/lib/store"
+)
+
+// record makes an enrollment with a fresh ID.
+func record() *lib.Enrollment {
+	return &lib.Enrollment{ID: lib.NewEnrollmentID(), Source: "image", Length: 16, HammingError: 4, Helpers: []byte("helpers")}
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range []string{BackendFile, BackendBolt} {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "enrollments")
+			s, err := Open(backend, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first, second, other := record(), record(), record()
+			for _, put := range []struct {
+				subject string
+				e       *lib.Enrollment
+			}{{"alice", first}, {"alice", second}, {"bob@example.org", other}} {
+				// Space the records out so they are stored at distinct times
+				time.Sleep(10 * time.Millisecond)
+				if err := s.Put(put.subject, put.e); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if e, err := s.Get("alice", ""); err != nil || e.ID != second.ID {
+				t.Errorf("Expected the last enrollment, got %v", err)
+			}
+			if e, err := s.Get("alice", first.ID); err != nil || e.ID != first.ID || string(e.Helpers) != "helpers" {
+				t.Errorf("Expected the first enrollment, got %v", err)
+			}
+			if _, err := s.Get("alice", other.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			if _, err := s.Get("carol", ""); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+
+			entries, err := s.List("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{first.ID, second.ID, other.ID}
+			if len(entries) != len(want) {
+				t.Fatalf("Expected %d entries, got %d", len(want), len(entries))
+			}
+			for i, id := range want {
+				if entries[i].ID != id {
+					t.Errorf("Entry %d is %s, expected %s", i, entries[i].ID, id)
+				}
+			}
+			if entries, _ := s.List("bob@example.org"); len(entries) != 1 || entries[0].Subject != "bob@example.org" {
+				t.Errorf("Unexpected entries of one subject %v", entries)
+			}
+
+			for _, subject := range []string{"", "../alice", ".lock", "a/b"} {
+				if err := s.Put(subject, record()); err == nil {
+					t.Errorf("Stored under subject %q", subject)
+				}
+			}
+			if err := s.Put("alice", &lib.Enrollment{Helpers: []byte("helpers")}); err == nil {
+				t.Error("Stored an enrollment without an ID")
+			}
+			if _, err := s.Get("alice", "../bob"); err == nil {
+				t.Error("Read an invalid enrollment ID")
+			}
+
+			// Records outlive the store that wrote them
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if s, err = Open(backend, path); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if err := s.Delete("alice", second.ID); err != nil {
+				t.Fatal(err)
+			}
+			if e, err := s.Get("alice", ""); err != nil || e.ID != first.ID {
+				t.Errorf("Expected the remaining enrollment, got %v", err)
+			}
+			if err := s.Delete("alice", second.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			if err := s.Delete("bob@example.org", ""); err != nil {
+				t.Fatal(err)
+			}
+			if entries, _ := s.List(""); len(entries) != 1 || entries[0].ID != first.ID {
+				t.Errorf("Unexpected entries after deletion %v", entries)
+			}
+		})
+	}
+}
+
+func TestFileStoreStored(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewFileStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := record(), record()
+	s.Put("alice", first)
+	time.Sleep(10 * time.Millisecond)
+	s.Put("alice", second)
+
+	// Copying or touching an older record does not make it the latest
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "alice", first.ID+".json"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := s.Get("alice", ""); err != nil || e.ID != second.ID {
+		t.Errorf("Expected the last stored enrollment, got %v", err)
+	}
+
+	// Plain enrollments are stored at their modification time
+	plain := record()
+	if err := lib.SaveEnrollment(filepath.Join(root, "alice", plain.ID+".json"), plain); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(root, "alice", plain.ID+".json"), future, future)
+	if e, err := s.Get("alice", ""); err != nil || e.ID != plain.ID {
+		t.Errorf("Expected the plain enrollment, got %v", err)
+	}
+}
+
+func TestFileStoreConcurrent(t *testing.T) {
+	root := t.TempDir()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Separate stores contend through the lock file only
+			s, err := NewFileStore(root)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := s.Put("alice", record()); err != nil {
+				errs <- err
+			}
+			if _, err := s.List(""); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	s, _ := NewFileStore(root)
+	if entries, err := s.List("alice"); err != nil || len(entries) != 16 {
+		t.Errorf("Expected 16 enrollments, got %d (%v)", len(entries), err)
+	}
+}
@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// SecretLength is the size of the secret shared between enrolled fingers.
+const SecretLength = 32
+
+// thresholdVersion is the version of serialized ThresholdHelpers, which always
+// carry a check value.
+const thresholdVersion = 2
+
+// ThresholdHelpers bundles the helpers of every enrolled finger with the share
+// of the combined secret locked under that finger's key, and a check value
+// that tells the combined secret apart from one built from a wrong share.
+type ThresholdHelpers[T Number] struct {
+	threshold int
+	helpers   []*Helpers[T]
+	shares    [][]byte
+	check     []byte
+}
+
+// ThresholdExtractor binds one key to several fingers, each enrolled through its
+// own FuzzyExtractor. Any `threshold` reproduced fingers recover the key, and a
+// finger that is not presented is passed to Rep as an empty value.
+type ThresholdExtractor[T Number] interface {
+	Gen(values []string) (Key, *ThresholdHelpers[T], error)
+	Rep(values []string, helper *ThresholdHelpers[T]) (Key, error)
+}
+
+type thresholdextractor[T Number] struct {
+	fes       []FuzzyExtractor[T]
+	threshold int
+}
+
+func NewThresholdExtractor[T Number](fes []FuzzyExtractor[T], threshold int) ThresholdExtractor[T] {
+	return &thresholdextractor[T]{
+		fes:       fes,
+		threshold: threshold,
+	}
+}
+
+func (te *thresholdextractor[T]) Gen(values []string) (Key, *ThresholdHelpers[T], error) {
+	if len(values) != len(te.fes) {
+		return "", nil, errors.New("gofze/lib/threshold.go: expected one value per finger")
+	}
+
+	keys := make([]Key, len(values))
+	helpers := make([]*Helpers[T], len(values))
+	for i, value := range values {
+		var err error
+		keys[i], helpers[i], err = te.fes[i].Gen(value)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	return GenThreshold(te.threshold, keys, helpers)
+}
+
+// Rep unlocks the share of every finger that reproduces and combines them
+// `threshold` at a time until the combined secret passes the check value, so
+// a finger that falsely matched or a tampered share is outvoted by the others.
+func (te *thresholdextractor[T]) Rep(values []string, helper *ThresholdHelpers[T]) (Key, error) {
+	if helper == nil {
+		return "", errors.New("gofze/lib/threshold.go: missing helpers")
+	}
+	if len(values) != len(te.fes) || len(helper.helpers) != len(te.fes) || len(helper.shares) != len(te.fes) {
+		return "", errors.New("gofze/lib/threshold.go: expected one value per finger")
+	}
+
+	shares := [][]byte{}
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+
+		key, err := te.fes[i].Rep(value, helper.helpers[i])
+		if err != nil {
+			continue
+		}
+
+		share, err := lockShare(key, helper.shares[i])
+		if err != nil {
+			return "", err
+		}
+		shares = append(shares, share)
+	}
+
+	if len(shares) < helper.threshold {
+		return "", errors.New("gofze/lib/threshold.go: too few fingers reproduced")
+	}
+
+	var secret []byte
+	subset := make([][]byte, helper.threshold)
+	combine(len(shares), helper.threshold, func(picked []int) bool {
+		for i, j := range picked {
+			subset[i] = shares[j]
+		}
+		combined, err := CombineShares(subset)
+		if err != nil || !hmac.Equal(checkValue(combined), helper.check) {
+			return true
+		}
+		secret = combined
+		return false
+	})
+
+	if secret == nil {
+		return "", errors.New("gofze/lib/threshold.go: reproduced shares do not combine to the key")
+	}
+	return Key(hex.EncodeToString(secret)), nil
+}
+
+// combine calls try with every k of n indices in lexicographic order, until
+// it returns false.
+func combine(n, k int, try func(picked []int) bool) {
+	picked := make([]int, k)
+	var pick func(from, i int) bool
+	pick = func(from, i int) bool {
+		if i == k {
+			return try(picked)
+		}
+		for j := from; j <= n-(k-i); j++ {
+			picked[i] = j
+			if !pick(j+1, i+1) {
+				return false
+			}
+		}
+		return true
+	}
+	pick(0, 0)
+}
+
+// checkValue commits to the combined secret without revealing it.
+func checkValue(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("gofze/lib/threshold.go check"))
+	return mac.Sum(nil)
+}
+
+// GenThreshold splits a fresh secret between fingers that were already enrolled,
+// for instance with GenMultiSample, and locks every share under its finger's key.
+func GenThreshold[T Number](threshold int, keys []Key, helpers []*Helpers[T]) (Key, *ThresholdHelpers[T], error) {
+	if len(keys) != len(helpers) {
+		return "", nil, errors.New("gofze/lib/threshold.go: expected one key per finger")
+	}
+
+	secret := make([]byte, SecretLength)
+	rand.Read(secret)
+	shares, err := SplitSecret(secret, len(keys), threshold)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for i := range shares {
+		if shares[i], err = lockShare(keys[i], shares[i]); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return Key(hex.EncodeToString(secret)), &ThresholdHelpers[T]{
+		threshold: threshold,
+		helpers:   helpers,
+		shares:    shares,
+		check:     checkValue(secret),
+	}, nil
+}
+
+// lockShare masks the y coordinates of a share with a pad derived from the
+// finger key. Applying it twice unlocks the share.
+func lockShare(key Key, share []byte) ([]byte, error) {
+	k, err := hex.DecodeString(string(key))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(share) != SecretLength+1 {
+		return nil, errors.New("gofze/lib/threshold.go: invalid share length")
+	}
+
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte("gofze/lib/threshold.go share"))
+	mac.Write(share[:1])
+	pad := mac.Sum(nil)
+
+	locked := append([]byte{}, share...)
+	for i := range SecretLength {
+		locked[i+1] ^= pad[i]
+	}
+	return locked, nil
+}
+
+// Threshold returns the number of fingers needed to reproduce the key.
+func (th *ThresholdHelpers[T]) Threshold() int {
+	return th.threshold
+}
+
+// Fingers returns the number of enrolled fingers.
+func (th *ThresholdHelpers[T]) Fingers() int {
+	return len(th.helpers)
+}
+
+// MarshalBinary serializes the container as "GFZT" | version | threshold |
+// fingers | check value, then per finger the length prefixed helpers and the
+// locked share.
+func (th *ThresholdHelpers[T]) MarshalBinary() ([]byte, error) {
+	if len(th.helpers) != len(th.shares) || len(th.helpers) > 255 || len(th.check) != sha256.Size {
+		return nil, errors.New("gofze/lib/threshold.go: malformed helpers")
+	}
+
+	b := append([]byte("GFZT"), thresholdVersion, byte(th.threshold), byte(len(th.helpers)))
+	b = append(b, th.check...)
+	for i := range th.helpers {
+		helpers, err := th.helpers[i].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(helpers)))
+		b = append(b, helpers...)
+		b = append(b, th.shares[i]...)
+	}
+	return b, nil
+}
+
+func (th *ThresholdHelpers[T]) UnmarshalBinary(data []byte) error {
+	if len(data) < 7 || string(data[:4]) != "GFZT" {
+		return errors.New("gofze/lib/threshold.go: invalid helpers")
+	}
+
+	if data[4] != thresholdVersion {
+		return errors.New("gofze/lib/threshold.go: unsupported helpers version")
+	}
+
+	threshold, fingers := int(data[5]), int(data[6])
+	if threshold < 1 || threshold > fingers {
+		return errors.New("gofze/lib/threshold.go: invalid threshold")
+	}
+
+	rest := data[7:]
+	if len(rest) < sha256.Size {
+		return errors.New("gofze/lib/threshold.go: truncated helpers")
+	}
+	check := append([]byte{}, rest[:sha256.Size]...)
+	rest = rest[sha256.Size:]
+	helpers := make([]*Helpers[T], fingers)
+	shares := make([][]byte, fingers)
+	for i := range fingers {
+		if len(rest) < 4 {
+			return errors.New("gofze/lib/threshold.go: truncated helpers")
+		}
+		n := int(binary.BigEndian.Uint32(rest))
+		if len(rest) < 4+n+SecretLength+1 {
+			return errors.New("gofze/lib/threshold.go: truncated helpers")
+		}
+
+		helpers[i] = &Helpers[T]{}
+		if err := helpers[i].UnmarshalBinary(rest[4 : 4+n]); err != nil {
+			return err
+		}
+		shares[i] = append([]byte{}, rest[4+n:4+n+SecretLength+1]...)
+		rest = rest[4+n+SecretLength+1:]
+	}
+
+	if len(rest) != 0 {
+		return errors.New("gofze/lib/threshold.go: trailing helpers data")
+	}
+
+	*th = ThresholdHelpers[T]{
+		threshold: threshold,
+		helpers:   helpers,
+		shares:    shares,
+		check:     check,
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package lib_test
+
+import (
+	"testing"
+
+	. "github.com/nart4hire/gofze/lib"
+)
+
+func TestThresholdExtractor(t *testing.T) {
+	fingers := []string{
+		"00112233445566778899aabbccddeeff",
+		"ffeeddccbbaa99887766554433221100",
+		"0123456789abcdef0123456789abcdef",
+	}
+
+	fe := NewDefaultFuzzy32Extractor(4, 2)
+	te := NewThresholdExtractor([]FuzzyExtractor[uint32]{fe, fe, fe}, 2)
+
+	key, helpers, err := te.Gen(fingers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := helpers.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &ThresholdHelpers[uint32]{}
+	if err := restored.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	key2, err := te.Rep([]string{"", fingers[1], fingers[2]}, restored)
+	if err != nil {
+		t.Fatal("Failed to reproduce key from two fingers")
+	}
+
+	if key != key2 {
+		t.Error("Key and reproduced key do not match")
+	}
+
+	// An impostor finger does not count towards the threshold
+	if _, err := te.Rep([]string{fingers[0], "", fingers[1]}, restored); err == nil {
+		t.Error("Expected a misplaced finger to be rejected")
+	}
+
+	if _, err := te.Rep([]string{fingers[0], "", ""}, restored); err == nil {
+		t.Error("Expected a single finger to be rejected")
+	}
+}
+
+func TestThresholdCheck(t *testing.T) {
+	fingers := []string{
+		"00112233445566778899aabbccddeeff",
+		"ffeeddccbbaa99887766554433221100",
+		"0123456789abcdef0123456789abcdef",
+	}
+
+	fe := NewDefaultFuzzy32Extractor(4, 2)
+	te := NewThresholdExtractor([]FuzzyExtractor[uint32]{fe, fe, fe}, 2)
+	key, helpers, err := te.Gen(fingers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := helpers.MarshalBinary()
+
+	// The last 33 bytes are the locked share of the third finger
+	tampered := append([]byte{}, b...)
+	tampered[len(tampered)-1] ^= 1
+	restored := &ThresholdHelpers[uint32]{}
+	if err := restored.UnmarshalBinary(tampered); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other fingers outvote the tampered share
+	if key2, err := te.Rep(fingers, restored); err != nil || key2 != key {
+		t.Errorf("Expected the untampered shares to reproduce the key, got %v", err)
+	}
+	if _, err := te.Rep([]string{"", fingers[1], fingers[2]}, restored); err == nil {
+		t.Error("Expected a tampered share to be detected")
+	}
+
+	// The check cannot be stripped by rewriting the version
+	stripped := append([]byte{}, b[:7]...)
+	stripped[4] = 1
+	stripped = append(stripped, b[7+32:]...)
+	if err := restored.UnmarshalBinary(stripped); err == nil {
+		t.Error("Expected helpers without a check value to be rejected")
+	}
+	if _, err := (&ThresholdHelpers[uint32]{}).MarshalBinary(); err == nil {
+		t.Error("Expected helpers without a check value not to be written")
+	}
+
+	if _, err := te.Rep(fingers, nil); err == nil {
+		t.Error("Expected missing helpers to be rejected")
+	}
+}
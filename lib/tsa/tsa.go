@@ -0,0 +1,485 @@
+// Package tsa requests and checks RFC 3161 timestamp tokens, so a signature
+// can be shown to have existed at a time vouched for by a timestamp authority
+// rather than by the clock of the signer. Tokens are CMS SignedData structures
+// whose content is a TSTInfo holding the hash of the timestamped data.
+//
+// Verify checks that a token is intact and signed by the certificate it
+// carries, which anyone can issue; Info.Trusted then checks that the
+// certificate chains to the authorities the caller trusts.
+package tsa
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidRSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidRSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA2 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA3 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA5 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519       = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+// Content types of the RFC 3161 HTTP transport.
+const (
+	QueryType = "application/timestamp-query"
+	ReplyType = "application/timestamp-reply"
+)
+
+// maxReply bounds the size of a reply read from a TSA.
+const maxReply = 1 << 20
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+	Extensions     asn1.RawValue         `asn1:"optional,tag:0"`
+}
+
+type statusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type response struct {
+	Status         statusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo    `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// signerInfo keeps the signer identifier raw, as it is either an issuer and
+// serial number or a [0] subject key identifier.
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// Info describes a verified timestamp token. Intermediates are the other
+// certificates the token carries.
+type Info struct {
+	Time          time.Time
+	SerialNumber  *big.Int
+	Policy        asn1.ObjectIdentifier
+	Certificate   *x509.Certificate
+	Intermediates []*x509.Certificate
+}
+
+// Trusted checks that the TSA certificate chains to roots, for timestamping,
+// and was valid at the time of the token.
+func (i *Info) Trusted(roots *x509.CertPool) error {
+	if roots == nil {
+		return errors.New("gofze/lib/tsa/tsa.go: no trusted timestamp authority")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range i.Intermediates {
+		intermediates.AddCert(c)
+	}
+	_, err := i.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   i.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	return err
+}
+
+// LoadCertPool reads the trusted timestamp authorities from a file of PEM
+// certificates, or of a single DER certificate.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !bytes.Contains(b, []byte("-----BEGIN")) {
+		c, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(c)
+		return pool, nil
+	}
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// hashes maps digest identifiers to hash functions.
+var hashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+func hashOf(algorithm pkix.AlgorithmIdentifier) (crypto.Hash, error) {
+	for _, h := range hashes {
+		if algorithm.Algorithm.Equal(h.oid) {
+			return h.hash, nil
+		}
+	}
+	return 0, errors.New("gofze/lib/tsa/tsa.go: unsupported digest algorithm")
+}
+
+// signatureAlgorithm maps the digest and signature algorithms of a signer
+// info onto the algorithm its certificate checks.
+func signatureAlgorithm(digest crypto.Hash, algorithm asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	switch {
+	case algorithm.Equal(oidRSA):
+		switch digest {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case algorithm.Equal(oidRSAWithSHA256):
+		return x509.SHA256WithRSA, nil
+	case algorithm.Equal(oidRSAWithSHA384):
+		return x509.SHA384WithRSA, nil
+	case algorithm.Equal(oidRSAWithSHA512):
+		return x509.SHA512WithRSA, nil
+	case algorithm.Equal(oidECDSAWithSHA2):
+		return x509.ECDSAWithSHA256, nil
+	case algorithm.Equal(oidECDSAWithSHA3):
+		return x509.ECDSAWithSHA384, nil
+	case algorithm.Equal(oidECDSAWithSHA5):
+		return x509.ECDSAWithSHA512, nil
+	case algorithm.Equal(oidEd25519):
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, errors.New("gofze/lib/tsa/tsa.go: unsupported signature algorithm")
+}
+
+// NewRequest returns a DER timestamp request for the SHA-256 hash of message
+// with a random nonce, asking for the TSA certificate to be included.
+func NewRequest(message []byte) ([]byte, *big.Int, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sum := sha256.Sum256(message)
+	der, err := asn1.Marshal(request{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			HashedMessage: sum[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	return der, nonce, err
+}
+
+// Timestamp asks the TSA at url for a token over message and returns the DER
+// token after checking that it answers the request.
+func Timestamp(url string, message []byte) ([]byte, error) {
+	req, nonce, err := NewRequest(message)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	reply, err := client.Post(url, QueryType, bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer reply.Body.Close()
+	if reply.StatusCode != http.StatusOK {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: TSA replied " + reply.Status)
+	}
+
+	der, err := io.ReadAll(io.LimitReader(reply.Body, maxReply))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := response{}
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: trailing reply data")
+	}
+
+	// Granted or granted with modifications
+	if resp.Status.Status > 1 || len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: timestamp refused")
+	}
+
+	token := resp.TimeStampToken.FullBytes
+	info, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: reply does not answer the request")
+	}
+
+	if _, err := Verify(token, message); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// parse returns the TSTInfo of a token without checking it.
+func parse(token []byte) (*tstInfo, error) {
+	_, info, _, err := unwrap(token)
+	return info, err
+}
+
+// unwrap splits a token into its signed data, TSTInfo and its DER encoding.
+func unwrap(token []byte) (*signedData, *tstInfo, []byte, error) {
+	ci := contentInfo{}
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, nil, nil, err
+	} else if len(rest) != 0 || !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, nil, errors.New("gofze/lib/tsa/tsa.go: not a SignedData token")
+	}
+
+	sd := &signedData{}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, sd); err != nil {
+		return nil, nil, nil, err
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, nil, errors.New("gofze/lib/tsa/tsa.go: token does not hold a TSTInfo")
+	}
+
+	econtent := []byte{}
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &econtent); err != nil {
+		return nil, nil, nil, err
+	}
+
+	info := &tstInfo{}
+	if rest, err := asn1.Unmarshal(econtent, info); err != nil {
+		return nil, nil, nil, err
+	} else if len(rest) != 0 {
+		return nil, nil, nil, errors.New("gofze/lib/tsa/tsa.go: trailing TSTInfo")
+	}
+	return sd, info, econtent, nil
+}
+
+// signer finds the certificate of the signer info among the certificates.
+func signer(sd *signedData, si signerInfo) (*x509.Certificate, error) {
+	sid := issuerAndSerialNumber{}
+	_, err := asn1.Unmarshal(si.SID.FullBytes, &sid)
+	byIssuer := err == nil && si.SID.Tag == asn1.TagSequence
+
+	for _, raw := range sd.Certificates {
+		c, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		if byIssuer && bytes.Equal(c.RawIssuer, sid.Issuer.FullBytes) && c.SerialNumber.Cmp(sid.SerialNumber) == 0 {
+			return c, nil
+		}
+		if !byIssuer && si.SID.Class == asn1.ClassContextSpecific && bytes.Equal(c.SubjectKeyId, si.SID.Bytes) {
+			return c, nil
+		}
+	}
+	return nil, errors.New("gofze/lib/tsa/tsa.go: TSA certificate not found, request it with certReq")
+}
+
+// Verify checks that token is an intact timestamp over message, signed by the
+// TSA certificate it carries, and returns when it was made.
+func Verify(token, message []byte) (*Info, error) {
+	sd, info, econtent, err := unwrap(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token must be over this message
+	h, err := hashOf(info.MessageImprint.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	imprint := h.New()
+	imprint.Write(message)
+	if !bytes.Equal(imprint.Sum(nil), info.MessageImprint.HashedMessage) {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: token is over other data")
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: expected a single TSA signer")
+	}
+	si := sd.SignerInfos[0]
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: token has no signed attributes")
+	}
+
+	cert, err := signer(sd, si)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signed attributes carry the digest of the TSTInfo and are signed
+	// re-tagged as a SET
+	digest, err := hashOf(si.DigestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	set, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+	if err != nil {
+		return nil, err
+	}
+	d := digest.New()
+	d.Write(econtent)
+	if err := checkAttributes(set, d.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	algorithm, err := signatureAlgorithm(digest, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.CheckSignature(algorithm, set, si.Signature); err != nil {
+		return nil, err
+	}
+
+	// RFC 3161 requires the TSA certificate to be for timestamping only
+	if !slices.Equal(cert.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}) {
+		return nil, errors.New("gofze/lib/tsa/tsa.go: certificate is not for timestamping")
+	}
+
+	intermediates := []*x509.Certificate{}
+	for _, raw := range sd.Certificates {
+		if c, err := x509.ParseCertificate(raw.FullBytes); err == nil && !c.Equal(cert) {
+			intermediates = append(intermediates, c)
+		}
+	}
+
+	return &Info{
+		Time:          info.GenTime,
+		SerialNumber:  info.SerialNumber,
+		Policy:        info.Policy,
+		Certificate:   cert,
+		Intermediates: intermediates,
+	}, nil
+}
+
+// checkAttributes requires the signed attributes to describe a TSTInfo whose
+// digest is messageDigest.
+func checkAttributes(set, messageDigest []byte) error {
+	attrs := []attribute{}
+	if _, err := asn1.UnmarshalWithParams(set, &attrs, "set"); err != nil {
+		return err
+	}
+
+	var contentType, digest bool
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			return errors.New("gofze/lib/tsa/tsa.go: malformed signed attribute")
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			oid := asn1.ObjectIdentifier{}
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &oid)
+			contentType = err == nil && oid.Equal(oidTSTInfo)
+		case attr.Type.Equal(oidMessageDigest):
+			d := []byte{}
+			_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &d)
+			digest = err == nil && bytes.Equal(d, messageDigest)
+		}
+	}
+
+	if !contentType || !digest {
+		return errors.New("gofze/lib/tsa/tsa.go: signed attributes do not match the token")
+	}
+	return nil
+}
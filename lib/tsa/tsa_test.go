@@ -0,0 +1,104 @@
+package tsa_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nart4hire/gofze/internal/tsatest"
+	. "github.com/nart4hire/gofze/lib/tsa"
+)
+
+// authority issues a self-signed TSA certificate for key.
+func authority(t *testing.T, key crypto.Signer, usage []x509.ExtKeyUsage) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3161),
+		Subject:      pkix.Name{CommonName: "gofze test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  usage,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTimestamp(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	signature := []byte("signature to timestamp")
+	for _, key := range []crypto.Signer{ecKey, rsaKey, edKey} {
+		cert := authority(t, key, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping})
+		server := httptest.NewServer(tsatest.NewResponder(key, cert))
+
+		before := time.Now().Add(-time.Second)
+		token, err := Timestamp(server.URL, signature)
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+
+		info, err := Verify(token, signature)
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		if info.Time.Before(before) || info.Time.After(time.Now()) {
+			t.Errorf("%T: unexpected time %v", key, info.Time)
+		}
+		if !info.Certificate.Equal(cert) || info.SerialNumber.Sign() <= 0 {
+			t.Errorf("%T: unexpected token %+v", key, info)
+		}
+
+		// Only the pinned authority is trusted
+		pinned := x509.NewCertPool()
+		pinned.AddCert(cert)
+		if err := info.Trusted(pinned); err != nil {
+			t.Errorf("%T: pinned authority not trusted: %v", key, err)
+		}
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		other := x509.NewCertPool()
+		other.AddCert(authority(t, otherKey, []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}))
+		if info.Trusted(other) == nil || info.Trusted(nil) == nil {
+			t.Errorf("%T: token of an untrusted authority was trusted", key)
+		}
+
+		if _, err := Verify(token, []byte("other signature")); err == nil {
+			t.Errorf("%T: token verified over other data", key)
+		}
+
+		// Flip a byte of the TSA signature at the end of the token
+		token[len(token)-1] ^= 1
+		if _, err := Verify(token, signature); err == nil {
+			t.Errorf("%T: corrupted token verified", key)
+		}
+		server.Close()
+	}
+}
+
+func TestTimestampUsage(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := authority(t, key, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning})
+	server := httptest.NewServer(tsatest.NewResponder(key, cert))
+	defer server.Close()
+
+	if _, err := Timestamp(server.URL, []byte("signature")); err == nil {
+		t.Error("Token of a certificate not for timestamping was accepted")
+	}
+}